@@ -0,0 +1,124 @@
+package tcp
+
+import (
+	"context"
+	"crypto/tls"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CertLoader loads a TLS certificate.
+type CertLoader func() (*tls.Certificate, error)
+
+// CertReloader provides the certificate of a TLS server, reloading it without restarting the server.
+// Once reloaded, the new certificate is used by the new handshakes only, the existing connections are kept.
+// It's used by setting its GetCertificate method on the TLSConfig of the server.
+type CertReloader struct {
+	// Interval is the duration between two checks of the certificate. If zero, it's one minute.
+	Interval time.Duration
+	// OnError is called on each failure to reload the certificate, if not nil.
+	// The previous certificate is kept.
+	OnError func(err error)
+
+	load    CertLoader
+	changed func() bool
+	cert    atomic.Value
+}
+
+const defaultReloadInterval = time.Minute
+
+// NewCertReloader returns a provider of the certificate loaded by the given function.
+// This function is called on each interval to reload it.
+func NewCertReloader(load CertLoader) (*CertReloader, error) {
+	r := &CertReloader{load: load}
+	return r, r.Reload()
+}
+
+// NewFileCertReloader returns a provider of the certificate of the given PEM files.
+// They are only reloaded once their modification time or their size changes.
+func NewFileCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	var (
+		mu   sync.Mutex
+		last string
+	)
+	r := &CertReloader{}
+	r.changed = func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		// Even if not readable, the files are considered as changed to report the error.
+		return stampFiles(certFile, keyFile) != last
+	}
+	r.load = func() (*tls.Certificate, error) {
+		stamp := stampFiles(certFile, keyFile)
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		mu.Lock()
+		last = stamp
+		mu.Unlock()
+		return &cert, nil
+	}
+	return r, r.Reload()
+}
+
+// stampFiles returns a value changing with the modification time or the size of one of the files.
+func stampFiles(names ...string) (stamp string) {
+	for _, name := range names {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return ""
+		}
+		stamp += fi.ModTime().String() + "/" + strconv.FormatInt(fi.Size(), 10) + ";"
+	}
+	return stamp
+}
+
+// GetCertificate returns the current certificate.
+// It implements the GetCertificate method of the tls.Config.
+func (r *CertReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert, _ := r.cert.Load().(*tls.Certificate)
+	if cert == nil {
+		return nil, ErrTLSHandshake
+	}
+	return cert, nil
+}
+
+// Reload loads the certificate now.
+// On failure, the previous certificate is kept.
+func (r *CertReloader) Reload() error {
+	cert, err := r.load()
+	if err != nil {
+		return err
+	}
+	r.cert.Store(cert)
+	return nil
+}
+
+// Watch reloads the certificate on each interval, until the context is done.
+// With the files, it's only reloaded when they have changed.
+// This method will block the calling goroutine until the context is done.
+func (r *CertReloader) Watch(ctx context.Context) {
+	d := r.Interval
+	if d <= 0 {
+		d = defaultReloadInterval
+	}
+	t := time.NewTicker(d)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if r.changed != nil && !r.changed() {
+				continue
+			}
+			if err := r.Reload(); err != nil && r.OnError != nil {
+				r.OnError(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package tcp_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/rvflash/tcp"
+)
+
+func TestNewCertReloader(t *testing.T) {
+	var (
+		are   = is.New(t)
+		oops  = errors.New("oops")
+		calls int
+	)
+	r, err := tcp.NewCertReloader(func() (*tls.Certificate, error) {
+		calls++
+		if calls > 1 {
+			return nil, oops
+		}
+		return &tls.Certificate{}, nil
+	})
+	are.NoErr(err)
+	cert, err := r.GetCertificate(nil)
+	are.NoErr(err)
+	are.True(cert != nil)       // expected certificate
+	are.Equal(r.Reload(), oops) // expected error
+	c2, err := r.GetCertificate(nil)
+	are.NoErr(err)
+	are.Equal(c2, cert) // expected previous certificate
+}
+
+func TestNewFileCertReloader(t *testing.T) {
+	are := is.New(t)
+	dir, err := ioutil.TempDir("", "tcp")
+	are.NoErr(err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	var (
+		certPath = filepath.Join(dir, "cert.pem")
+		keyPath  = filepath.Join(dir, "key.pem")
+	)
+	are.NoErr(writeCert(certPath, keyPath, "first"))
+	_, err = tcp.NewFileCertReloader(certPath, filepath.Join(dir, "missing.pem"))
+	are.True(err != nil) // expected missing file
+
+	r, err := tcp.NewFileCertReloader(certPath, keyPath)
+	are.NoErr(err)
+	are.Equal(commonName(t, r), "first") // mismatch certificate
+
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		errs        = make(chan error, 10)
+	)
+	defer cancel()
+	r.Interval = 10 * time.Millisecond
+	r.OnError = func(err error) {
+		errs <- err
+	}
+	go r.Watch(ctx)
+
+	// Rotates the certificate.
+	are.NoErr(writeCert(certPath, keyPath, "second"))
+	time.Sleep(50 * time.Millisecond)
+	are.Equal(commonName(t, r), "second") // mismatch reloaded certificate
+	are.Equal(len(errs), 0)               // unexpected error
+
+	// Breaks the certificate.
+	are.NoErr(ioutil.WriteFile(keyPath, []byte("oops"), 0600))
+	are.True(<-errs != nil)               // expected error
+	are.Equal(commonName(t, r), "second") // expected previous certificate
+}
+
+func commonName(t *testing.T, r *tcp.CertReloader) string {
+	are := is.New(t)
+	cert, err := r.GetCertificate(nil)
+	are.NoErr(err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	are.NoErr(err)
+	return leaf.Subject.CommonName
+}
+
+// writeCert writes a new self-signed certificate with the given common name.
+func writeCert(certPath, keyPath, name string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	kb, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kb}), 0600)
+}
@@ -0,0 +1,250 @@
+// Package client provides a TCP client sharing the framing of the tcp server.
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rvflash/tcp"
+)
+
+// ErrClosed is returned when the client is used after its closing.
+var ErrClosed = tcp.NewError("client closed")
+
+// Handler sends a request and returns its response.
+type Handler func(ctx context.Context, req []byte) ([]byte, error)
+
+// Middleware wraps a Handler to extend its behavior.
+type Middleware func(next Handler) Handler
+
+// DialFunc opens a new connection.
+type DialFunc func(ctx context.Context) (net.Conn, error)
+
+const network = "tcp"
+
+// TCP returns a DialFunc connecting to the given TCP address.
+func TCP(addr string) DialFunc {
+	return func(ctx context.Context) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+}
+
+// TLS returns a DialFunc connecting to the given TCP address using the TLS protocol.
+func TLS(addr string, config *tls.Config) DialFunc {
+	return func(ctx context.Context) (net.Conn, error) {
+		var d net.Dialer
+		c, err := d.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		tc := tls.Client(c, config)
+		if err = handshake(ctx, tc); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+		return tc, nil
+	}
+}
+
+func handshake(ctx context.Context, c *tls.Conn) error {
+	stop := watch(ctx, c)
+	defer stop()
+	err := c.Handshake()
+	if err != nil {
+		return contextErr(ctx, err)
+	}
+	return nil
+}
+
+// New returns a new client using the given function to open its connection.
+// The connection is opened on the first call and re-opened after any network failure.
+func New(dial DialFunc) *Client {
+	return &Client{dial: dial}
+}
+
+// Dial connects to the given TCP address.
+func Dial(addr string) (*Client, error) {
+	return dialNow(New(TCP(addr)))
+}
+
+// DialTLS connects to the given TCP address using the TLS protocol.
+func DialTLS(addr string, config *tls.Config) (*Client, error) {
+	return dialNow(New(TLS(addr, config)))
+}
+
+func dialNow(c *Client) (*Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := c.connect(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Client is a TCP client. It sends one request at a time and waits for its response.
+// It's safe for concurrent use by multiple goroutines.
+type Client struct {
+	// Framer frames each request and splits the responses.
+	// If nil, each message is delimited by a new line, as with tcp.NewLineFramer.
+	Framer tcp.Framer
+	// Timeout is the maximum duration of a call when its context has no deadline.
+	// A zero value means no timeout.
+	Timeout time.Duration
+
+	dial        DialFunc
+	middlewares []Middleware
+
+	mu     sync.Mutex
+	conn   net.Conn
+	r      *bufio.Reader
+	closed bool
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return c.disconnect()
+}
+
+// Do sends the request and returns its response, passing through the middlewares.
+// The deadline of the context is applied on the call.
+func (c *Client) Do(ctx context.Context, req []byte) ([]byte, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Deadline(); !ok && c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	h := c.roundTrip
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		h = c.middlewares[i](h)
+	}
+	return h(ctx, req)
+}
+
+// Use adds middleware(s) on each call.
+// The first one is the outermost.
+func (c *Client) Use(m ...Middleware) {
+	c.middlewares = append(c.middlewares, m...)
+}
+
+func (c *Client) connect(ctx context.Context) error {
+	if c.closed {
+		return ErrClosed
+	}
+	if c.conn != nil {
+		return nil
+	}
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.r = bufio.NewReader(conn)
+	return nil
+}
+
+func (c *Client) disconnect() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn, c.r = nil, nil
+	return err
+}
+
+func (c *Client) framer() tcp.Framer {
+	if c.Framer == nil {
+		return tcp.NewLineFramer()
+	}
+	return c.Framer
+}
+
+func (c *Client) roundTrip(ctx context.Context, req []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := exchange(ctx, c.conn, c.r, c.framer(), req)
+	if err != nil {
+		// The connection is in an unknown state, it will be re-opened on the next call.
+		_ = c.disconnect()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// exchange writes the request on the connection and reads its response.
+func exchange(ctx context.Context, conn net.Conn, r *bufio.Reader, f tcp.Framer, req []byte) ([]byte, error) {
+	b, err := f.Frame(req)
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := ctx.Deadline(); ok {
+		err = conn.SetDeadline(d)
+	} else {
+		err = conn.SetDeadline(time.Time{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	stop := watch(ctx, conn)
+	defer stop()
+
+	if _, err = conn.Write(b); err == nil {
+		b, err = f.ReadFrame(r)
+	}
+	if err != nil {
+		return nil, contextErr(ctx, err)
+	}
+	return b, nil
+}
+
+// contextErr returns the error of the context if it's the cause of the given error.
+func contextErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if e, ok := err.(net.Error); ok && e.Timeout() {
+		// The deadline of the connection may expire just before the one of the context.
+		if d, ok := ctx.Deadline(); ok && !time.Now().Before(d) {
+			return context.DeadlineExceeded
+		}
+	}
+	return err
+}
+
+// watch interrupts any pending operation on the connection once the context is done.
+// The returned function stops watching and waits for it, so the connection can not be interrupted
+// once the function returns, even during the next operation.
+func watch(ctx context.Context, conn net.Conn) (stop func()) {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
@@ -0,0 +1,135 @@
+package client_test
+
+import (
+	"context"
+	"crypto/tls"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/rvflash/tcp"
+	"github.com/rvflash/tcp/client"
+)
+
+const (
+	addr    = ":9130"
+	tlsAddr = ":9131"
+	eol     = "\n"
+	hi      = "hi"
+)
+
+func TestMain(m *testing.M) {
+	srv := newServer()
+	go func() {
+		_ = srv.Run(addr)
+	}()
+	tlsSrv := newServer()
+	go func() {
+		_ = tlsSrv.RunTLS(tlsAddr, "../testdata/server.pem", "../testdata/server.key")
+	}()
+	time.Sleep(time.Millisecond * 100)
+	m.Run()
+}
+
+// newServer returns a server echoing each message.
+// The message "sleep" is answered after 100 milliseconds, the message "quit" closes the connection.
+func newServer() *tcp.Server {
+	srv := tcp.New()
+	srv.Dispatch = tcp.Sequential
+	srv.ACK(func(c *tcp.Context) {
+		b, err := c.ReadAll()
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		switch strings.TrimSpace(string(b)) {
+		case "sleep":
+			time.Sleep(time.Millisecond * 100)
+		case "quit":
+			_ = c.Close()
+			return
+		}
+		c.String(string(b))
+	})
+	return srv
+}
+
+func TestDial(t *testing.T) {
+	are := is.New(t)
+	c, err := client.Dial(addr)
+	are.NoErr(err)
+	resp, err := c.Do(context.Background(), []byte(hi))
+	are.NoErr(err)
+	are.Equal(string(resp), hi+eol) // mismatch response
+	are.NoErr(c.Close())
+	_, err = c.Do(context.Background(), []byte(hi))
+	are.Equal(err, client.ErrClosed) // expected closed client
+	// Unknown address
+	_, err = client.Dial(":1")
+	are.True(err != nil) // expected dial error
+}
+
+func TestDialTLS(t *testing.T) {
+	are := is.New(t)
+	c, err := client.DialTLS(tlsAddr, &tls.Config{InsecureSkipVerify: true})
+	are.NoErr(err)
+	defer func() {
+		are.NoErr(c.Close())
+	}()
+	resp, err := c.Do(nil, []byte(hi))
+	are.NoErr(err)
+	are.Equal(string(resp), hi+eol) // mismatch response
+}
+
+func TestClient_Do(t *testing.T) {
+	are := is.New(t)
+	c := client.New(client.TCP(addr))
+	defer func() {
+		are.NoErr(c.Close())
+	}()
+	// Deadline exceeded
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	_, err := c.Do(ctx, []byte("sleep"))
+	cancel()
+	are.Equal(err, context.DeadlineExceeded)
+	// Default timeout
+	c.Timeout = 10 * time.Millisecond
+	_, err = c.Do(context.Background(), []byte("sleep"))
+	are.Equal(err, context.DeadlineExceeded)
+	c.Timeout = 0
+	// Reconnects after the previous failures.
+	resp, err := c.Do(context.Background(), []byte(hi))
+	are.NoErr(err)
+	are.Equal(string(resp), hi+eol) // mismatch response
+	// Connection closed by the server.
+	_, err = c.Do(context.Background(), []byte("quit"))
+	are.True(err != nil) // expected EOF
+	resp, err = c.Do(context.Background(), []byte(hi))
+	are.NoErr(err)
+	are.Equal(string(resp), hi+eol) // mismatch response after reconnection
+	// The context of a call done does not interrupt the next ones.
+	for i := 0; i < 50; i++ {
+		ctx, cancel = context.WithCancel(context.Background())
+		_, err = c.Do(ctx, []byte(hi))
+		cancel()
+		are.NoErr(err)
+		resp, err = c.Do(context.Background(), []byte(hi))
+		are.NoErr(err)
+		are.Equal(string(resp), hi+eol) // mismatch response after a canceled context
+	}
+}
+
+func TestClient_Framer(t *testing.T) {
+	are := is.New(t)
+	c := client.New(client.TCP(addr))
+	c.Framer = tcp.NewFixedLengthFramer(3)
+	defer func() {
+		are.NoErr(c.Close())
+	}()
+	_, err := c.Do(context.Background(), []byte(hi))
+	are.Equal(err, tcp.ErrFrameSize)
+	resp, err := c.Do(context.Background(), []byte(hi+eol))
+	are.NoErr(err)
+	are.Equal(string(resp), hi+eol) // mismatch response
+}
@@ -0,0 +1,55 @@
+package client
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/rvflash/tcp"
+	"github.com/sirupsen/logrus"
+)
+
+// Logger returns a middleware to log each call.
+// The fields of the entry are the ones of the tcp.Logger: latency, request and response sizes.
+func Logger(log *logrus.Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req []byte) ([]byte, error) {
+			start := time.Now()
+			resp, err := next(ctx, req)
+			latency := time.Since(start)
+			entry := logrus.NewEntry(log).WithFields(logrus.Fields{
+				tcp.LogLatency:      int(math.Ceil(float64(latency.Nanoseconds()) / float64(time.Millisecond))),
+				tcp.LogRequestSize:  len(req),
+				tcp.LogResponseSize: len(resp),
+			})
+			msg := "[TCP] " + start.UTC().Format(time.RFC3339) + " | CALL"
+			if err != nil {
+				entry.Warnf("%s %s", msg, err)
+			} else {
+				entry.Info(msg)
+			}
+			return resp, err
+		}
+	}
+}
+
+// Retry returns a middleware retrying a failed call up to the given number of attempts.
+// It waits backoff multiplied by the number of the attempt between two of them.
+// As a request may have been received before the failure, it should only be used with idempotent requests.
+func Retry(attempts int, backoff time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req []byte) (resp []byte, err error) {
+			for i := 1; ; i++ {
+				resp, err = next(ctx, req)
+				if err == nil || i >= attempts || ctx.Err() != nil {
+					return
+				}
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(backoff * time.Duration(i)):
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/rvflash/tcp"
+	"github.com/rvflash/tcp/client"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestLogger(t *testing.T) {
+	are := is.New(t)
+	log, hook := test.NewNullLogger()
+	c := client.New(client.TCP(addr))
+	c.Use(client.Logger(log))
+	defer func() {
+		are.NoErr(c.Close())
+	}()
+	_, err := c.Do(context.Background(), []byte(hi))
+	are.NoErr(err)
+	entry := hook.LastEntry()
+	are.Equal(entry.Level, logrus.InfoLevel)              // level mismatch
+	are.Equal(entry.Data[tcp.LogRequestSize], len(hi))    // request size mismatch
+	are.Equal(entry.Data[tcp.LogResponseSize], len(hi)+1) // response size mismatch
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = c.Do(ctx, []byte("sleep"))
+	are.True(err != nil)
+	are.Equal(hook.LastEntry().Level, logrus.WarnLevel) // level mismatch
+}
+
+func TestRetry(t *testing.T) {
+	var (
+		are   = is.New(t)
+		calls int
+		oops  = errors.New("oops")
+	)
+	c := client.New(client.TCP(addr))
+	c.Use(client.Retry(3, time.Millisecond), func(next client.Handler) client.Handler {
+		return func(ctx context.Context, req []byte) ([]byte, error) {
+			calls++
+			if calls < 3 {
+				return nil, oops
+			}
+			return next(ctx, req)
+		}
+	})
+	defer func() {
+		are.NoErr(c.Close())
+	}()
+	resp, err := c.Do(context.Background(), []byte(hi))
+	are.NoErr(err)
+	are.Equal(string(resp), hi+eol) // mismatch response
+	are.Equal(calls, 3)             // mismatch attempts
+	// Too many failures
+	calls = -10
+	_, err = c.Do(context.Background(), []byte(hi))
+	are.Equal(err, oops)
+	are.Equal(calls, -7) // mismatch attempts
+}
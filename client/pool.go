@@ -0,0 +1,371 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rvflash/tcp"
+)
+
+// ErrBadConn is returned by the default health check when a connection can not be reused.
+var ErrBadConn = tcp.NewError("bad connection")
+
+const (
+	defaultMaxIdle        = 2
+	defaultMaintainPeriod = time.Second
+)
+
+// NewPool returns a new pool of connections, opened with the given function.
+// The settings of the pool must be defined before its first use.
+func NewPool(dial DialFunc) *Pool {
+	return &Pool{
+		dial:    dial,
+		release: make(chan struct{}),
+		closing: make(chan struct{}),
+	}
+}
+
+// Pool maintains a pool of connections to a server.
+// Each call uses its own connection, it's safe for concurrent use by multiple goroutines.
+type Pool struct {
+	// Framer frames each request and splits the responses.
+	// If nil, each message is delimited by a new line, as with tcp.NewLineFramer.
+	Framer tcp.Framer
+	// MaxOpen is the maximum number of open connections, in use or idle.
+	// A zero value means no limit. When it's reached, a call waits for a free connection or the end of its context.
+	MaxOpen int
+	// MinIdle is the minimum number of idle connections kept open in background.
+	MinIdle int
+	// MaxIdle is the maximum number of idle connections. If zero, 2 are kept. A negative value means none.
+	MaxIdle int
+	// MaxLifetime is the maximum duration a connection may be reused. A zero value means no limit.
+	MaxLifetime time.Duration
+	// IdleTimeout is the maximum duration a connection may be idle. A zero value means no limit.
+	IdleTimeout time.Duration
+	// HealthCheck verifies an idle connection before its reuse.
+	// If nil, the connection is rejected when it's closed by the server or when it has unread data.
+	HealthCheck func(net.Conn) error
+
+	dial        DialFunc
+	middlewares []Middleware
+	once        sync.Once
+
+	mu      sync.Mutex
+	idle    []*poolConn
+	inUse   int
+	release chan struct{}
+	closed  bool
+	closing chan struct{}
+	stats   PoolStats
+}
+
+// PoolStats contains statistics about the pool.
+type PoolStats struct {
+	// MaxOpen is the maximum number of open connections.
+	MaxOpen int
+	// Open is the number of established connections, in use or idle.
+	Open int
+	// InUse is the number of connections currently in use.
+	InUse int
+	// Idle is the number of idle connections.
+	Idle int
+	// WaitCount is the total number of calls waited for a connection.
+	WaitCount int64
+	// WaitDuration is the total time blocked waiting for a connection.
+	WaitDuration time.Duration
+	// MaxIdleClosed is the total number of connections closed due to MaxIdle.
+	MaxIdleClosed int64
+	// MaxLifetimeClosed is the total number of connections closed due to MaxLifetime or IdleTimeout.
+	MaxLifetimeClosed int64
+}
+
+type poolConn struct {
+	net.Conn
+	r       *bufio.Reader
+	created time.Time
+	used    time.Time
+}
+
+// Close closes all the idle connections and prevents new calls.
+// The connections in use are closed at the end of their call.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.closing)
+	p.signal()
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+
+	var err error
+	for _, c := range idle {
+		if e := c.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Do sends the request on one of the connections of the pool and returns its response,
+// passing through the middlewares.
+func (p *Pool) Do(ctx context.Context, req []byte) ([]byte, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	p.once.Do(func() {
+		go p.maintain()
+	})
+	h := p.roundTrip
+	for i := len(p.middlewares) - 1; i >= 0; i-- {
+		h = p.middlewares[i](h)
+	}
+	return h(ctx, req)
+}
+
+// Stats returns the statistics of the pool.
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.stats
+	s.MaxOpen = p.MaxOpen
+	s.InUse = p.inUse
+	s.Idle = len(p.idle)
+	s.Open = s.InUse + s.Idle
+	return s
+}
+
+// Use adds middleware(s) on each call.
+// The first one is the outermost.
+func (p *Pool) Use(m ...Middleware) {
+	p.middlewares = append(p.middlewares, m...)
+}
+
+func (p *Pool) roundTrip(ctx context.Context, req []byte) ([]byte, error) {
+	c, err := p.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f := p.Framer
+	if f == nil {
+		f = tcp.NewLineFramer()
+	}
+	resp, err := exchange(ctx, c.Conn, c.r, f, req)
+	p.put(c, err)
+	return resp, err
+}
+
+// conn returns an idle connection or a new one, waiting for a free slot if necessary.
+func (p *Pool) conn(ctx context.Context) (*poolConn, error) {
+	p.mu.Lock()
+	var start time.Time
+	for {
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrClosed
+		}
+		if p.MaxOpen <= 0 || p.inUse+len(p.idle) < p.MaxOpen || len(p.idle) > 0 {
+			break
+		}
+		if start.IsZero() {
+			start = time.Now()
+			p.stats.WaitCount++
+		}
+		release := p.release
+		p.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			p.mu.Lock()
+			p.stats.WaitDuration += time.Since(start)
+			p.mu.Unlock()
+			return nil, ctx.Err()
+		case <-release:
+		}
+		p.mu.Lock()
+	}
+	if !start.IsZero() {
+		p.stats.WaitDuration += time.Since(start)
+	}
+	p.inUse++
+	for len(p.idle) > 0 {
+		c := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		if p.expired(c, time.Now()) {
+			p.stats.MaxLifetimeClosed++
+			_ = c.Close()
+			continue
+		}
+		p.mu.Unlock()
+		if p.check(c) == nil {
+			return c, nil
+		}
+		_ = c.Close()
+		p.mu.Lock()
+	}
+	p.mu.Unlock()
+
+	c, err := p.open(ctx)
+	if err != nil {
+		p.mu.Lock()
+		p.inUse--
+		p.signal()
+		p.mu.Unlock()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (p *Pool) check(c *poolConn) error {
+	if p.HealthCheck != nil {
+		return p.HealthCheck(c.Conn)
+	}
+	if c.r.Buffered() > 0 {
+		// Unexpected data.
+		return ErrBadConn
+	}
+	err := c.SetReadDeadline(time.Now())
+	if err != nil {
+		return err
+	}
+	_, err = c.r.Peek(1)
+	if e, ok := err.(net.Error); !ok || !e.Timeout() {
+		// Unexpected data or connection closed by the server.
+		return ErrBadConn
+	}
+	return c.SetReadDeadline(time.Time{})
+}
+
+func (p *Pool) expired(c *poolConn, now time.Time) bool {
+	if p.MaxLifetime > 0 && now.Sub(c.created) >= p.MaxLifetime {
+		return true
+	}
+	return p.IdleTimeout > 0 && now.Sub(c.used) >= p.IdleTimeout
+}
+
+func (p *Pool) maxIdle() int {
+	switch {
+	case p.MaxIdle == 0:
+		return defaultMaxIdle
+	case p.MaxIdle < 0:
+		return 0
+	default:
+		return p.MaxIdle
+	}
+}
+
+func (p *Pool) open(ctx context.Context) (*poolConn, error) {
+	c, err := p.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &poolConn{Conn: c, r: bufio.NewReader(c), created: now, used: now}, nil
+}
+
+// put releases the connection, keeping it as idle if it's still reusable.
+func (p *Pool) put(c *poolConn, err error) {
+	c.used = time.Now()
+	p.mu.Lock()
+	p.inUse--
+	switch {
+	case err != nil || p.closed:
+		_ = c.Close()
+	case p.expired(c, c.used):
+		p.stats.MaxLifetimeClosed++
+		_ = c.Close()
+	case len(p.idle) >= p.maxIdle():
+		p.stats.MaxIdleClosed++
+		_ = c.Close()
+	default:
+		p.idle = append(p.idle, c)
+	}
+	p.signal()
+	p.mu.Unlock()
+}
+
+// signal wakes up the calls waiting for a connection.
+// The lock must be held.
+func (p *Pool) signal() {
+	close(p.release)
+	p.release = make(chan struct{})
+}
+
+// maintain closes the expired idle connections and opens new ones to keep the minimum of idle connections.
+func (p *Pool) maintain() {
+	t := time.NewTicker(p.maintainPeriod())
+	defer t.Stop()
+	for {
+		p.clean()
+		p.fill()
+		select {
+		case <-p.closing:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (p *Pool) maintainPeriod() time.Duration {
+	d := defaultMaintainPeriod
+	for _, v := range []time.Duration{p.MaxLifetime / 2, p.IdleTimeout / 2} {
+		if v > 0 && v < d {
+			d = v
+		}
+	}
+	return d
+}
+
+func (p *Pool) clean() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var (
+		now  = time.Now()
+		idle = p.idle[:0]
+	)
+	for _, c := range p.idle {
+		if p.expired(c, now) {
+			p.stats.MaxLifetimeClosed++
+			_ = c.Close()
+			continue
+		}
+		idle = append(idle, c)
+	}
+	p.idle = idle
+}
+
+func (p *Pool) fill() {
+	for {
+		p.mu.Lock()
+		ok := !p.closed && len(p.idle) < p.MinIdle && len(p.idle) < p.maxIdle() &&
+			(p.MaxOpen <= 0 || p.inUse+len(p.idle) < p.MaxOpen)
+		if ok {
+			// Reserves the slot while dialing.
+			p.inUse++
+		}
+		p.mu.Unlock()
+		if !ok {
+			return
+		}
+		c, err := p.open(context.Background())
+		p.mu.Lock()
+		p.inUse--
+		if err == nil {
+			if p.closed {
+				_ = c.Close()
+			} else {
+				p.idle = append(p.idle, c)
+			}
+		}
+		p.signal()
+		p.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
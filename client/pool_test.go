@@ -0,0 +1,126 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/rvflash/tcp/client"
+)
+
+func TestPool_Do(t *testing.T) {
+	are := is.New(t)
+	p := client.NewPool(client.TCP(addr))
+	p.MaxOpen = 1
+	defer func() {
+		are.NoErr(p.Close())
+	}()
+	resp, err := p.Do(context.Background(), []byte(hi))
+	are.NoErr(err)
+	are.Equal(string(resp), hi+eol) // mismatch response
+	s := p.Stats()
+	are.Equal(s.Open, 1)  // mismatch open connections
+	are.Equal(s.Idle, 1)  // mismatch idle connections
+	are.Equal(s.InUse, 0) // mismatch in use connections
+
+	// Waits for the free connection.
+	var w8 sync.WaitGroup
+	w8.Add(1)
+	go func() {
+		defer w8.Done()
+		_, err := p.Do(context.Background(), []byte("sleep"))
+		are.NoErr(err)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	resp, err = p.Do(context.Background(), []byte(hi))
+	are.NoErr(err)
+	are.Equal(string(resp), hi+eol) // mismatch response
+	w8.Wait()
+	s = p.Stats()
+	are.Equal(s.WaitCount, int64(1)) // mismatch waits
+	are.True(s.WaitDuration > 0)     // missing wait duration
+	are.Equal(s.Open, 1)             // mismatch open connections
+
+	// Exhausted pool
+	w8.Add(1)
+	go func() {
+		defer w8.Done()
+		_, err := p.Do(context.Background(), []byte("sleep"))
+		are.NoErr(err)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = p.Do(ctx, []byte(hi))
+	are.Equal(err, context.DeadlineExceeded)
+	w8.Wait()
+
+	// Closed pool
+	are.NoErr(p.Close())
+	_, err = p.Do(context.Background(), []byte(hi))
+	are.Equal(err, client.ErrClosed)
+}
+
+func TestPool_HealthCheck(t *testing.T) {
+	are := is.New(t)
+	p := client.NewPool(client.TCP(addr))
+	defer func() {
+		are.NoErr(p.Close())
+	}()
+	// The server closes the connection, so the pool has to open a new one.
+	_, err := p.Do(context.Background(), []byte("quit"))
+	are.True(err != nil) // expected EOF
+	are.Equal(p.Stats().Open, 0)
+	_, err = p.Do(context.Background(), []byte(hi))
+	are.NoErr(err)
+	are.Equal(p.Stats().Idle, 1)
+
+	// Custom check
+	var checks int
+	p.HealthCheck = func(net.Conn) error {
+		checks++
+		return errors.New("oops")
+	}
+	_, err = p.Do(context.Background(), []byte(hi))
+	are.NoErr(err)
+	are.Equal(checks, 1)
+}
+
+func TestPool_MinIdle(t *testing.T) {
+	are := is.New(t)
+	p := client.NewPool(client.TCP(addr))
+	p.MinIdle = 2
+	p.MaxIdle = 3
+	p.IdleTimeout = 50 * time.Millisecond
+	p.MaxLifetime = time.Minute
+	defer func() {
+		are.NoErr(p.Close())
+	}()
+	_, err := p.Do(context.Background(), []byte(hi))
+	are.NoErr(err)
+	time.Sleep(10 * time.Millisecond)
+	are.True(p.Stats().Idle >= 2) // missing idle connections
+	// The expired connections are replaced.
+	time.Sleep(100 * time.Millisecond)
+	s := p.Stats()
+	are.Equal(s.Idle, 2)               // mismatch idle connections
+	are.True(s.MaxLifetimeClosed >= 2) // expected expired connections
+}
+
+func TestPool_MaxIdle(t *testing.T) {
+	are := is.New(t)
+	p := client.NewPool(client.TCP(addr))
+	p.MaxIdle = -1
+	defer func() {
+		are.NoErr(p.Close())
+	}()
+	_, err := p.Do(context.Background(), []byte(hi))
+	are.NoErr(err)
+	s := p.Stats()
+	are.Equal(s.Idle, 0)                 // mismatch idle connections
+	are.Equal(s.MaxIdleClosed, int64(1)) // mismatch closed connections
+}
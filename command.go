@@ -0,0 +1,53 @@
+package tcp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+)
+
+// CommandParser extracts the command and its arguments from the body of a message.
+type CommandParser func(msg []byte) (command string, args []string, err error)
+
+// ParseCommand is the default CommandParser.
+// It splits the message around each instance of one or more consecutive white spaces.
+// The first word is the command, the following ones are its arguments.
+func ParseCommand(msg []byte) (command string, args []string, err error) {
+	f := strings.Fields(string(msg))
+	if len(f) == 0 {
+		return "", nil, nil
+	}
+	return f[0], f[1:], nil
+}
+
+func (s *Server) commandParser() CommandParser {
+	if s.CommandParser == nil {
+		return ParseCommand
+	}
+	return s.CommandParser
+}
+
+// routeCommand parses the message and returns the handlers of its command.
+// The body of the request remains readable.
+func (s *Server) routeCommand(ctx *Context) []HandlerFunc {
+	var buf []byte
+	if ctx.Request.Body != nil {
+		buf, _ = ioutil.ReadAll(ctx.Request.Body)
+		ctx.Request.Body = ioutil.NopCloser(bytes.NewReader(buf))
+	}
+	var err error
+	ctx.command, ctx.args, err = s.commandParser()(buf)
+	if err != nil {
+		ctx.Error(err)
+	} else if h, ok := s.commands[commandName(ctx.command)]; ok {
+		return h
+	}
+	if s.notFound != nil {
+		return s.notFound
+	}
+	return s.computeHandlers(ACK)
+}
+
+func commandName(name string) string {
+	return strings.ToUpper(name)
+}
@@ -0,0 +1,116 @@
+package tcp_test
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/rvflash/tcp"
+)
+
+func TestParseCommand(t *testing.T) {
+	var (
+		dt = []struct {
+			in      string
+			command string
+			args    []string
+		}{
+			{},
+			{in: " \r\n"},
+			{in: "PING\r\n", command: "PING", args: []string{}},
+			{in: "get  key\n", command: "get", args: []string{"key"}},
+			{in: "SET key value\n", command: "SET", args: []string{"key", "value"}},
+		}
+		are = is.New(t)
+	)
+	for i, tt := range dt {
+		tt := tt
+		t.Run("#"+strconv.Itoa(i), func(t *testing.T) {
+			command, args, err := tcp.ParseCommand([]byte(tt.in))
+			are.NoErr(err)
+			are.Equal(command, tt.command) // mismatch command
+			are.Equal(args, tt.args)       // mismatch arguments
+		})
+	}
+}
+
+func TestServer_Command(t *testing.T) {
+	var (
+		dt = []struct {
+			in,
+			out,
+			outWithNotFound string
+		}{
+			{in: "GET key\n", out: "GET[key]" + eol, outWithNotFound: "GET[key]" + eol},
+			{in: "get key\n", out: "get[key]" + eol, outWithNotFound: "get[key]" + eol},
+			{in: "SET key value\n", out: "SET[key value]" + eol, outWithNotFound: "SET[key value]" + eol},
+			{in: "DEL key\n", out: "ACK" + eol, outWithNotFound: "unknown command DEL" + eol},
+			{in: "\n", out: "ACK" + eol, outWithNotFound: "unknown command " + eol},
+		}
+		are = is.New(t)
+	)
+	for _, notFound := range []bool{false, true} {
+		srv := tcp.New()
+		srv.Command("GET", command)
+		srv.Command("set", command)
+		srv.ACK(func(c *tcp.Context) {
+			c.String(tcp.ACK)
+		})
+		if notFound {
+			srv.NotFound(func(c *tcp.Context) {
+				c.String("unknown command " + c.Command())
+			})
+		}
+		for i, tt := range dt {
+			tt := tt
+			t.Run(strconv.FormatBool(notFound)+"#"+strconv.Itoa(i), func(t *testing.T) {
+				rec := tcp.NewRecorder()
+				srv.ServeTCP(rec, tcp.NewRequest(tcp.ACK, strings.NewReader(tt.in)))
+				if notFound {
+					are.Equal(rec.Body.String(), tt.outWithNotFound) // mismatch response
+				} else {
+					are.Equal(rec.Body.String(), tt.out) // mismatch response
+				}
+			})
+		}
+	}
+}
+
+func TestServer_CommandParser(t *testing.T) {
+	var (
+		are = is.New(t)
+		srv = tcp.New()
+		err = errors.New("oops")
+	)
+	srv.CommandParser = func(msg []byte) (string, []string, error) {
+		if len(msg) == 0 {
+			return "", nil, err
+		}
+		p := strings.Split(strings.TrimSpace(string(msg)), ":")
+		return p[0], p[1:], nil
+	}
+	srv.Command("GET", command)
+	srv.NotFound(func(c *tcp.Context) {
+		c.String(c.Err().Error())
+	})
+	// Valid command
+	rec := tcp.NewRecorder()
+	srv.ServeTCP(rec, tcp.NewRequest(tcp.ACK, strings.NewReader("GET:a:b\n")))
+	are.Equal(rec.Body.String(), "GET[a b]"+eol)
+	// Parsing error
+	rec = tcp.NewRecorder()
+	srv.ServeTCP(rec, tcp.NewRequest(tcp.ACK, nil))
+	are.Equal(rec.Body.String(), err.Error()+eol)
+}
+
+// command writes the command and its arguments, then checks the body is still readable.
+func command(c *tcp.Context) {
+	b, err := c.ReadAll()
+	if err != nil || len(b) == 0 {
+		c.Error(errors.New("unreadable body"))
+		return
+	}
+	c.String(c.Command() + "[" + strings.Join(c.Args(), " ") + "]")
+}
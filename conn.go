@@ -4,43 +4,431 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/tls"
+	"errors"
 	"io"
 	"net"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// Conn represents a client connection, alive from its SYN segment until its FIN segment.
+// It's shared by all the requests of the connection.
+type Conn interface {
+	// ID returns the unique identifier of the connection on the server.
+	ID() uint64
+	// LocalAddr returns the local network address.
+	LocalAddr() net.Addr
+	// RemoteAddr returns the remote network address.
+	RemoteAddr() net.Addr
+	// StartTime returns the time at which the connection was accepted.
+	StartTime() time.Time
+	// Received returns the number of messages received on the connection.
+	Received() uint64
+	// Sent returns the number of responses written on the connection.
+	Sent() uint64
+	// Get returns the value stored with the given key and whether it exists.
+	Get(key string) (value interface{}, exists bool)
+	// Set stores the value with the given key.
+	Set(key string, value interface{})
+	// Delete removes the value stored with the given key.
+	Delete(key string)
+	// Send writes the message on the connection, framed by the Framer of the server.
+	// It can be used outside of any request, by example to push a notification.
+	Send(msg []byte) error
+	// Close closes the connection.
+	Close() error
+}
+
 type conn struct {
-	addr string
-	rwc  net.Conn
-	srv  *Server
+	addr  string
+	ip    string
+	id    uint64
+	ln    net.Listener
+	srv   *Server
+	start time.Time
+
+	// underlying connection, switched by the upgrade to TLS
+	nmu sync.RWMutex
+	rwc net.Conn
+	tls *tls.ConnectionState
+
+	// reader of the messages, paused by the upgrade to TLS
+	rmu       sync.Mutex
+	br        *bufio.Reader
+	umu       sync.Mutex
+	pausing   int32
+	draining  int32
+	hijacking int32
+	state     int32
+	doneOnce  sync.Once
+	startTLS  *tls.Config
+	tlsReq    uint64
+	resume    chan struct{}
+
+	// counters
+	received,
+	sent,
+	requests uint64
+
+	// connection's store
+	mu   sync.RWMutex
+	keys M
+
+	// serializes the writes
+	wmu sync.Mutex
+
+	// outbound queue of the published messages
+	out     chan []byte
+	outOnce sync.Once
+	done    chan struct{}
+
+	// reason of the closing
+	errMu sync.Mutex
+	err   error
+}
+
+// Close implements the Conn interface.
+func (c *conn) Close() error {
+	return c.netConn().Close()
+}
+
+// netConn returns the underlying connection.
+func (c *conn) netConn() net.Conn {
+	c.nmu.RLock()
+	defer c.nmu.RUnlock()
+	return c.rwc
+}
+
+// Delete implements the Conn interface.
+func (c *conn) Delete(key string) {
+	c.mu.Lock()
+	delete(c.keys, key)
+	c.mu.Unlock()
+}
+
+// Get implements the Conn interface.
+func (c *conn) Get(key string) (value interface{}, exists bool) {
+	c.mu.RLock()
+	value, exists = c.keys[key]
+	c.mu.RUnlock()
+	return
+}
+
+// ID implements the Conn interface.
+func (c *conn) ID() uint64 {
+	return c.id
+}
+
+// LocalAddr implements the Conn interface.
+func (c *conn) LocalAddr() net.Addr {
+	return c.netConn().LocalAddr()
+}
+
+// Received implements the Conn interface.
+func (c *conn) Received() uint64 {
+	return atomic.LoadUint64(&c.received)
+}
+
+// RemoteAddr implements the Conn interface.
+func (c *conn) RemoteAddr() net.Addr {
+	return c.netConn().RemoteAddr()
+}
+
+// Send implements the Conn interface.
+func (c *conn) Send(msg []byte) error {
+	b, err := c.srv.framer().Frame(msg)
+	if err != nil {
+		return err
+	}
+	return c.writeMessage(b)
+}
+
+// writeMessage writes the framed message on the connection, counting it as sent.
+func (c *conn) writeMessage(b []byte) error {
+	n, err := c.Write(b)
+	if n > 0 {
+		atomic.AddUint64(&c.sent, 1)
+	}
+	return err
+}
+
+// Sent implements the Conn interface.
+func (c *conn) Sent() uint64 {
+	return atomic.LoadUint64(&c.sent)
+}
+
+// Set implements the Conn interface.
+func (c *conn) Set(key string, value interface{}) {
+	c.mu.Lock()
+	if c.keys == nil {
+		c.keys = make(M)
+	}
+	c.keys[key] = value
+	c.mu.Unlock()
+}
+
+// StartTime implements the Conn interface.
+func (c *conn) StartTime() time.Time {
+	return c.start
+}
+
+// Write implements the io.WriteCloser interface.
+// Concurrent writes are serialized, each one is written at once.
+// If the write times out, the connection is closed.
+func (c *conn) Write(p []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.hijacked() {
+		return 0, ErrHijacked
+	}
+	rwc := c.netConn()
+	if c.srv.WriteTimeout > 0 {
+		err := rwc.SetWriteDeadline(time.Now().Add(c.srv.WriteTimeout))
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := rwc.Write(p)
+	if isTimeout(err) {
+		c.setErr(ErrWriteTimeout)
+		_ = rwc.Close()
+	}
+	return n, err
+}
+
+// frame contains the body of a segment or the error reported with it.
+type frame struct {
+	body []byte
+	err  error
+}
+
+// bySegment serves the segment, writing the response on the connection.
+// If the server buffers the responses, the buffer is flushed at the end of the request.
+// Once the response sent, the connection is upgraded to TLS if requested by this request.
+func (c *conn) bySegment(ctx context.Context, segment string, f frame) {
+	if c.srv.WriteBufferSize <= 0 {
+		id := c.serveSegment(ctx, c, segment, f)
+		c.upgrade(id)
+		return
+	}
+	w := &bufferedWriter{w: c, c: c, size: c.srv.WriteBufferSize}
+	id := c.serveSegment(ctx, w, segment, f)
+	_ = w.Flush()
+	c.upgrade(id)
 }
 
-func (c *conn) bySegment(ctx context.Context, segment string, body io.Reader) {
+// serveSegment serves the segment, writing the response on wc. It returns the identifier of the request.
+func (c *conn) serveSegment(ctx context.Context, wc io.WriteCloser, segment string, f frame) uint64 {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	w := newWriter(c.rwc)
-	req := c.newRequest(segment, body).WithContext(ctx)
+	w := newWriter(wc)
+	req := c.newRequest(segment, f).WithContext(ctx)
 	c.srv.ServeTCP(w, req)
+	if w.Size() > 0 {
+		// One response, whatever the number of writes.
+		atomic.AddUint64(&c.sent, 1)
+	}
+	return req.id
 }
 
-func (c *conn) newRequest(segment string, body io.Reader) *Request {
+func (c *conn) newRequest(segment string, f frame) *Request {
+	var body io.Reader
+	if f.body != nil {
+		body = bytes.NewReader(f.body)
+	}
 	req := NewRequest(segment, body)
 	req.RemoteAddr = c.addr
+	req.Listener = c.ln
+	req.TLS = c.tlsState()
+	req.conn = c
+	req.id = atomic.AddUint64(&c.requests, 1)
+	req.err = f.err
 	return req
 }
 
+// deadline returns the deadline after the given timeout, limited by the lifetime of the connection.
+// A zero value means no deadline.
+func (c *conn) deadline(timeout time.Duration) (t time.Time) {
+	if timeout > 0 {
+		t = time.Now().Add(timeout)
+	}
+	if c.srv.MaxLifetime > 0 {
+		end := c.start.Add(c.srv.MaxLifetime)
+		if t.IsZero() || end.Before(t) {
+			t = end
+		}
+	}
+	return
+}
+
+// readFrame waits for the next message, then reads it, applying the timeouts of the server.
+// It returns errPaused if the reading is interrupted by an upgrade of the connection.
+func (c *conn) readFrame(f Framer) ([]byte, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	if c.hijacked() {
+		return nil, errHijacked
+	}
+	rwc := c.netConn()
+	err := rwc.SetReadDeadline(c.deadline(c.srv.IdleTimeout))
+	if err != nil {
+		return nil, err
+	}
+	if c.paused() {
+		return nil, errPaused
+	}
+	if c.drained() {
+		return nil, errDrained
+	}
+	c.setState(StateIdle)
+	_, err = c.br.Peek(1)
+	if err != nil {
+		return nil, c.readErr(err, ErrIdleTimeout)
+	}
+	c.setState(StateActive)
+	err = rwc.SetReadDeadline(c.deadline(c.srv.ReadTimeout))
+	if err != nil {
+		return nil, err
+	}
+	// This deadline may have replaced the one interrupting the reading.
+	if c.paused() {
+		return nil, errPaused
+	}
+	if c.drained() {
+		return nil, errDrained
+	}
+	b, err := c.srv.readFrame(f, c.br)
+	if err != nil {
+		return nil, c.readErr(err, ErrReadTimeout)
+	}
+	return b, nil
+}
+
+// readErr returns errPaused or errDrained if the reading has been interrupted by an upgrade
+// or a drain of the connection. Otherwise, it returns the error or the given reason in case of timeout.
+func (c *conn) readErr(err, reason error) error {
+	if c.paused() {
+		return errPaused
+	}
+	if c.drained() {
+		return errDrained
+	}
+	return c.timeoutErr(err, reason)
+}
+
+// errDrained is returned when the reading is interrupted by a drain of the connection.
+var errDrained = errors.New("drained")
+
+// drain stops the reading of the messages.
+func (c *conn) drain() {
+	atomic.StoreInt32(&c.draining, 1)
+	_ = c.netConn().SetReadDeadline(aLongTimeAgo)
+}
+
+// drained returns true if the connection is drained.
+func (c *conn) drained() bool {
+	return atomic.LoadInt32(&c.draining) == 1
+}
+
+// timeoutErr returns the given reason if the error is a timeout,
+// or ErrMaxLifetime if the connection has reached its lifetime.
+func (c *conn) timeoutErr(err, reason error) error {
+	if !isTimeout(err) {
+		return err
+	}
+	if c.srv.MaxLifetime > 0 && !time.Now().Before(c.start.Add(c.srv.MaxLifetime)) {
+		return ErrMaxLifetime
+	}
+	return reason
+}
+
+// reason returns the reason of the closing of the connection, if any.
+func (c *conn) reason() error {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	return c.err
+}
+
+// setErr records the first TCP error as reason of the closing of the connection.
+func (c *conn) setErr(err error) {
+	if _, ok := err.(*Error); !ok {
+		return
+	}
+	c.errMu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.errMu.Unlock()
+}
+
+func isTimeout(err error) bool {
+	e, ok := err.(net.Error)
+	return ok && e.Timeout()
+}
+
 func (c *conn) serve(ctx context.Context) {
+	c.srv.trackConn(c, true)
+	// The reader is ready before the SYN segment, which can hijack the connection.
+	c.rmu.Lock()
+	c.br = bufio.NewReader(c.netConn())
+	c.rmu.Unlock()
+	d := c.newDispatcher()
 	// New connection
-	go c.bySegment(ctx, SYN, nil)
+	d.syn(ctx)
 	// Waiting for messages
-	r := bufio.NewReader(c.rwc)
+	f := c.srv.framer()
 	for {
-		d, err := r.ReadBytes('\n')
+		b, err := c.readFrame(f)
+		if err == errPaused {
+			c.waitUpgrade()
+			continue
+		}
+		if err == errDrained {
+			c.setErr(ErrServerClosed)
+			break
+		}
+		if err == errHijacked {
+			// Owned by the handler.
+			close(c.done)
+			return
+		}
+		if err == ErrMessageTooLarge {
+			if c.srv.MessageTooLargeReply != nil {
+				_ = c.Send(c.srv.MessageTooLargeReply)
+			}
+			if c.srv.Oversize == SkipMessage {
+				// Served without body, reporting the error.
+				atomic.AddUint64(&c.received, 1)
+				d.ack(ctx, frame{err: err})
+				continue
+			}
+		}
 		if err != nil {
+			c.setErr(err)
 			break
 		}
-		go c.bySegment(ctx, ACK, bytes.NewReader(d))
+		atomic.AddUint64(&c.received, 1)
+		d.ack(ctx, frame{body: b})
+	}
+	c.setState(StateClosing)
+	d.wait()
+	if c.hijacked() {
+		// Hijacked by a handler in progress.
+		close(c.done)
+		return
+	}
+	if c.drained() && c.srv.DrainMessage != nil {
+		_ = c.Send(c.srv.DrainMessage)
 	}
 	// Connection closed
-	c.bySegment(ctx, FIN, nil)
+	c.srv.trackConn(c, false)
+	c.srv.leaveAll(c)
+	c.bySegment(ctx, FIN, frame{err: c.reason()})
+	// Closes it if the server has ended the reading.
+	_ = c.Close()
+	c.setState(StateClosed)
+	close(c.done)
 }
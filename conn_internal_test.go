@@ -0,0 +1,28 @@
+package tcp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestConn_Write(t *testing.T) {
+	var (
+		are      = is.New(t)
+		cli, srv = net.Pipe()
+		c        = &conn{rwc: srv, srv: &Server{WriteTimeout: 10 * time.Millisecond}}
+	)
+	defer func() {
+		_ = cli.Close()
+	}()
+	// Nobody reads the response.
+	_, err := c.Write([]byte(msgWithEol))
+	are.True(isTimeout(err))               // expected timeout
+	are.Equal(c.reason(), ErrWriteTimeout) // mismatch reason
+	are.Equal(c.Sent(), uint64(0))         // mismatch sent messages
+	// Connection closed
+	_, err = cli.Read(make([]byte, 1))
+	are.True(err != nil) // expected closed pipe
+}
@@ -0,0 +1,202 @@
+package tcp_test
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/rvflash/tcp"
+)
+
+const userKey = "user"
+
+func TestContext_Conn(t *testing.T) {
+	const addr = ":9127"
+	var (
+		are = is.New(t)
+		srv = tcp.New()
+		fin = make(chan tcp.Conn, 1)
+	)
+	srv.Dispatch = tcp.Sequential
+	srv.SYN(func(c *tcp.Context) {
+		c.Conn().Set(userKey, "bob")
+		c.Conn().Set(stringKeyName, stringKeyValue)
+	})
+	srv.ACK(func(c *tcp.Context) {
+		c.Conn().Delete(stringKeyName)
+		_, ok := c.Conn().Get(stringKeyName)
+		// One response in two writes.
+		_, _ = c.Write([]byte(c.GetString(userKey) + " "))
+		c.String(fmt.Sprintf("%d %t", c.Conn().Received(), ok))
+	})
+	srv.FIN(func(c *tcp.Context) {
+		fin <- c.Conn()
+	})
+	go func() {
+		are.NoErr(srv.Run(addr))
+	}()
+	time.Sleep(time.Millisecond * 100)
+
+	cli, err := net.Dial("tcp", addr)
+	are.NoErr(err)
+	r := bufio.NewReader(cli)
+	for _, s := range []string{"bob 1 false" + eol, "bob 2 false" + eol} {
+		are.NoErr(writeConn(cli, hiMsg))
+		out, err := r.ReadString('\n')
+		are.NoErr(err)
+		are.Equal(out, s) // mismatch response
+	}
+	are.NoErr(cli.Close())
+
+	c := <-fin
+	are.True(c.ID() > 0)                                         // missing identifier
+	are.Equal(c.RemoteAddr().String(), cli.LocalAddr().String()) // mismatch remote address
+	are.Equal(c.LocalAddr().String(), cli.RemoteAddr().String()) // mismatch local address
+	are.True(!c.StartTime().IsZero())                            // missing start time
+	are.Equal(c.Received(), uint64(2))                           // mismatch received messages
+	are.Equal(c.Sent(), uint64(2))                               // mismatch sent messages
+	are.Equal(c.(interface {
+		Get(string) (interface{}, bool)
+	}) != nil, true)
+}
+
+func TestContext_Conn2(t *testing.T) {
+	c := newContext(newDefaultRequest())
+	is.New(t).True(c.Conn() == nil)
+}
+
+func TestServer_Timeouts(t *testing.T) {
+	var (
+		dt = []struct {
+			addr string
+			srv  *tcp.Server
+			msgs []string
+			err  error
+		}{
+			{addr: ":9128", srv: &tcp.Server{IdleTimeout: 50 * time.Millisecond}, err: tcp.ErrIdleTimeout},
+			{addr: ":9129", srv: &tcp.Server{ReadTimeout: 50 * time.Millisecond}, msgs: []string{"hel"}, err: tcp.ErrReadTimeout},
+			{addr: ":9132", srv: &tcp.Server{MaxLifetime: 50 * time.Millisecond, IdleTimeout: time.Second}, err: tcp.ErrMaxLifetime},
+			{
+				// The idle timeout is reset on each message.
+				addr: ":9133",
+				srv:  &tcp.Server{IdleTimeout: 50 * time.Millisecond},
+				msgs: []string{hiMsg, hiMsg, hiMsg, hiMsg},
+				err:  tcp.ErrIdleTimeout,
+			},
+		}
+		are = is.New(t)
+	)
+	for i, tt := range dt {
+		tt := tt
+		t.Run("#"+strconv.Itoa(i), func(t *testing.T) {
+			var (
+				srv = tcp.New()
+				fin = make(chan error, 1)
+				ack = make(chan struct{}, len(tt.msgs))
+			)
+			srv.IdleTimeout = tt.srv.IdleTimeout
+			srv.ReadTimeout = tt.srv.ReadTimeout
+			srv.MaxLifetime = tt.srv.MaxLifetime
+			srv.ACK(func(c *tcp.Context) {
+				ack <- struct{}{}
+			})
+			srv.FIN(func(c *tcp.Context) {
+				fin <- c.Err()
+			})
+			go func() {
+				are.NoErr(srv.Run(tt.addr))
+			}()
+			time.Sleep(time.Millisecond * 100)
+
+			cli, err := net.Dial("tcp", tt.addr)
+			are.NoErr(err)
+			defer func() {
+				_ = cli.Close()
+			}()
+			start := time.Now()
+			for _, s := range tt.msgs {
+				are.NoErr(writeConn(cli, s))
+				time.Sleep(30 * time.Millisecond)
+			}
+			select {
+			case err = <-fin:
+				are.Equal(err, tcp.Errors{tt.err}) // mismatch reason
+			case <-time.After(time.Second):
+				t.Fatal("expected closing")
+			}
+			are.True(time.Since(start) >= time.Duration(len(tt.msgs))*30*time.Millisecond) // closed too early
+		})
+	}
+}
+
+func TestServer_Range(t *testing.T) {
+	const (
+		addr = ":9135"
+		news = "news"
+	)
+	var (
+		are = is.New(t)
+		srv = tcp.New()
+		syn = make(chan uint64, 2)
+		fin = make(chan uint64, 2)
+	)
+	srv.SYN(func(c *tcp.Context) {
+		syn <- c.Conn().ID()
+	})
+	srv.FIN(func(c *tcp.Context) {
+		fin <- c.Conn().ID()
+	})
+	go func() {
+		are.NoErr(srv.Run(addr))
+	}()
+	time.Sleep(time.Millisecond * 100)
+
+	var clients [2]net.Conn
+	for i := range clients {
+		cli, err := net.Dial("tcp", addr)
+		are.NoErr(err)
+		clients[i] = cli
+		<-syn
+	}
+	// Pushes a notification to all the clients.
+	var n int
+	srv.Range(func(c tcp.Conn) bool {
+		n++
+		are.NoErr(c.Send([]byte(news)))
+		return true
+	})
+	are.Equal(n, len(clients)) // mismatch live connections
+	for _, cli := range clients {
+		out, err := bufio.NewReader(cli).ReadString('\n')
+		are.NoErr(err)
+		are.Equal(out, news+eol) // mismatch notification
+	}
+	// Stops the iteration.
+	n = 0
+	srv.Range(func(c tcp.Conn) bool {
+		n++
+		return false
+	})
+	are.Equal(n, 1) // expected only one iteration
+	// Closes the first connection.
+	are.NoErr(clients[0].Close())
+	id := <-fin
+	_, ok := srv.Conn(id)
+	are.True(!ok) // expected closed connection
+	n = 0
+	srv.Range(func(c tcp.Conn) bool {
+		_, ok = srv.Conn(c.ID())
+		are.True(ok) // expected live connection
+		n++
+		// Server side closing
+		are.NoErr(c.Close())
+		return true
+	})
+	are.Equal(n, 1) // mismatch live connections
+	are.True(<-fin != id)
+	_ = clients[1].Close()
+}
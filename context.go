@@ -19,6 +19,8 @@ type Context struct {
 	// Keys is a key/value pair allows data sharing inside the context of each request.
 	Shared M
 
+	command  string
+	args     []string
 	errs     Errors
 	index    int
 	handlers []HandlerFunc
@@ -34,6 +36,11 @@ func (c *Context) Abort() {
 	c.index = abortIndex
 }
 
+// Args returns the arguments of the command of the message.
+func (c *Context) Args() []string {
+	return c.args
+}
+
 // Canceled is a shortcut to listen the request's cancellation.
 func (c *Context) Canceled() <-chan struct{} {
 	if c.Request == nil {
@@ -42,12 +49,36 @@ func (c *Context) Canceled() <-chan struct{} {
 	return c.Request.Canceled()
 }
 
+// ShuttingDown returns a channel closed once the server is shutting down,
+// to let the long-lived handlers end cooperatively.
+func (c *Context) ShuttingDown() <-chan struct{} {
+	if c.srv == nil {
+		return nil
+	}
+	return c.srv.closing
+}
+
 // Close immediately closes the connection.
 // An error is returned when we fail to do it.
 func (c *Context) Close() error {
 	return c.writer.Close()
 }
 
+// Command returns the command of the message.
+// It's only set when at least one command is registered on the server.
+func (c *Context) Command() string {
+	return c.command
+}
+
+// Conn returns the connection of the request, shared from its SYN segment until its FIN segment.
+// It returns nil if the request is not bound to any connection.
+func (c *Context) Conn() Conn {
+	if c.Request == nil || c.Request.conn == nil {
+		return nil
+	}
+	return c.Request.conn
+}
+
 // Error reports a new error.
 func (c *Context) Error(err error) {
 	c.errs = append(c.errs, err)
@@ -60,12 +91,18 @@ func (c *Context) Err() Errors {
 }
 
 // Get retrieves the value associated to the given key inside the embed shared memory.
-// If it's not exists, the request's context value is used as fail over.
+// If it's not exists, the connection's store, then the request's context value are used as fail over.
 func (c *Context) Get(key string) (value interface{}, exists bool) {
 	value, exists = c.Shared[key]
 	if exists || c.Request == nil {
 		return
 	}
+	if c.Request.conn != nil {
+		value, exists = c.Request.conn.Get(key)
+		if exists {
+			return
+		}
+	}
 	// fail over based on context values
 	value = c.Request.Context().Value(key)
 	exists = value != nil
@@ -126,6 +163,25 @@ func (c *Context) GetString(key string) (value string) {
 	return
 }
 
+// Join subscribes the connection to the topic. See Server.Publish.
+// The subscription ends with the connection or by calling Leave.
+func (c *Context) Join(topic string) error {
+	if c.Request == nil || c.Request.conn == nil {
+		return ErrRequest
+	}
+	c.Request.conn.srv.join(c.Request.conn, topic)
+	return nil
+}
+
+// Leave unsubscribes the connection from the topic.
+func (c *Context) Leave(topic string) error {
+	if c.Request == nil || c.Request.conn == nil {
+		return ErrRequest
+	}
+	c.Request.conn.srv.leave(c.Request.conn, topic)
+	return nil
+}
+
 // Next should be used only inside middleware.
 // It executes the pending handlers in the chain inside the calling handler.
 func (c *Context) Next() {
@@ -148,21 +204,47 @@ func (c *Context) ReadAll() ([]byte, error) {
 }
 
 // String writes the given string on the current connection.
+// If the server defines a Framer, the string is framed by it.
 func (c *Context) String(s string) {
-	const eom = "\n"
-	if !strings.HasSuffix(s, eom) {
-		// sends it now, ending the message.
-		s += eom
+	var err error
+	if c.framer() != nil {
+		_, err = c.Write([]byte(s))
+	} else {
+		const eom = "\n"
+		if !strings.HasSuffix(s, eom) {
+			// sends it now, ending the message.
+			s += eom
+		}
+		_, err = c.writer.WriteString(s)
 	}
-	_, err := c.writer.WriteString(s)
 	if err != nil {
 		c.Error(err)
 	}
 }
 
 // Write implements the Conn interface.
+// If the server defines a Framer, d is written as one message framed by it.
 func (c *Context) Write(d []byte) (int, error) {
-	return c.writer.Write(d)
+	f := c.framer()
+	if f == nil {
+		return c.writer.Write(d)
+	}
+	b, err := f.Frame(d)
+	if err != nil {
+		return 0, err
+	}
+	_, err = c.writer.Write(b)
+	if err != nil {
+		return 0, err
+	}
+	return len(d), nil
+}
+
+func (c *Context) framer() Framer {
+	if c.srv == nil {
+		return nil
+	}
+	return c.srv.Framer
 }
 
 /*
@@ -178,4 +260,6 @@ func (c *Context) reset() {
 	c.handlers = nil
 	c.index = -1
 	c.errs = nil
+	c.command = ""
+	c.args = nil
 }
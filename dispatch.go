@@ -0,0 +1,140 @@
+package tcp
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// DispatchMode defines how the messages received on a same connection are handled.
+type DispatchMode int
+
+// List of supported dispatch modes.
+const (
+	// Concurrent handles each message in its own goroutine, without any guarantee on the order of the responses.
+	// The SYN segment is also handled in its own goroutine. It's the default mode.
+	// If Server.Workers is set, the messages are handled by this bounded pool of goroutines instead.
+	Concurrent DispatchMode = iota
+	// Sequential handles the SYN segment, then each message in order of reception, then the FIN segment.
+	Sequential
+	// Pipelined handles the SYN segment, then concurrently up to Server.MaxPipelined messages,
+	// delivering their responses in order of reception. Finally, it handles the FIN segment.
+	Pipelined
+)
+
+// dispatcher handles the segments of a connection according to the dispatch mode of the server.
+type dispatcher interface {
+	// syn handles the new connection.
+	syn(ctx context.Context)
+	// ack handles a new message.
+	ack(ctx context.Context, f frame)
+	// wait blocks until all the messages are handled.
+	wait()
+}
+
+func (c *conn) newDispatcher() dispatcher {
+	switch c.srv.Dispatch {
+	case Sequential:
+		return &sequential{c: c}
+	case Pipelined:
+		n := c.srv.MaxPipelined
+		if n <= 0 {
+			n = runtime.GOMAXPROCS(0)
+		}
+		return &pipeline{
+			c:    c,
+			sem:  make(chan struct{}, n),
+			prev: closedChan(),
+		}
+	default:
+		return &concurrent{c: c}
+	}
+}
+
+type concurrent struct {
+	c  *conn
+	w8 sync.WaitGroup
+}
+
+func (d *concurrent) syn(ctx context.Context) {
+	d.w8.Add(1)
+	go func() {
+		defer d.w8.Done()
+		d.c.bySegment(ctx, SYN, frame{})
+	}()
+}
+
+func (d *concurrent) ack(ctx context.Context, f frame) {
+	d.w8.Add(1)
+	if d.c.srv.Workers > 0 {
+		d.c.srv.submit(job{ctx: ctx, c: d.c, f: f, done: d.w8.Done})
+		return
+	}
+	go func() {
+		defer d.w8.Done()
+		d.c.bySegment(ctx, ACK, f)
+	}()
+}
+
+func (d *concurrent) wait() {
+	d.w8.Wait()
+}
+
+type sequential struct {
+	c *conn
+}
+
+func (d *sequential) syn(ctx context.Context) {
+	d.c.bySegment(ctx, SYN, frame{})
+}
+
+func (d *sequential) ack(ctx context.Context, f frame) {
+	d.c.bySegment(ctx, ACK, f)
+}
+
+func (d *sequential) wait() {}
+
+type pipeline struct {
+	c    *conn
+	sem  chan struct{}
+	prev chan struct{}
+	w8   sync.WaitGroup
+}
+
+func (d *pipeline) syn(ctx context.Context) {
+	d.c.bySegment(ctx, SYN, frame{})
+}
+
+func (d *pipeline) ack(ctx context.Context, f frame) {
+	// Limits the number of messages in progress.
+	d.sem <- struct{}{}
+	prev, done := d.prev, make(chan struct{})
+	d.prev = done
+	d.w8.Add(1)
+	go func() {
+		defer func() {
+			<-d.sem
+			d.w8.Done()
+		}()
+		// The response can not be flushed before its turn.
+		w := &bufferedWriter{c: d.c}
+		id := d.c.serveSegment(ctx, w, ACK, f)
+		// Waits for the response of the previous message before sending its own.
+		<-prev
+		if w.buf.Len() > 0 {
+			_, _ = d.c.Write(w.buf.Bytes())
+		}
+		d.c.upgrade(id)
+		close(done)
+	}()
+}
+
+func (d *pipeline) wait() {
+	d.w8.Wait()
+}
+
+func closedChan() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}
@@ -0,0 +1,66 @@
+package tcp_test
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/rvflash/tcp"
+)
+
+func TestServer_Dispatch(t *testing.T) {
+	var (
+		dt = []struct {
+			addr string
+			mode tcp.DispatchMode
+		}{
+			{addr: ":9125", mode: tcp.Sequential},
+			{addr: ":9126", mode: tcp.Pipelined},
+		}
+		are = is.New(t)
+	)
+	for i, tt := range dt {
+		tt := tt
+		t.Run("#"+strconv.Itoa(i), func(t *testing.T) {
+			srv := tcp.New()
+			srv.Dispatch = tt.mode
+			srv.MaxPipelined = 2
+			srv.SYN(welcome)
+			srv.ACK(echoAfterSleep)
+			go func() {
+				are.NoErr(srv.Run(tt.addr))
+			}()
+			time.Sleep(time.Millisecond * 100)
+
+			cli, err := net.Dial("tcp", tt.addr)
+			are.NoErr(err)
+			defer func() {
+				are.NoErr(cli.Close())
+			}()
+			// The first messages are the slowest to handle.
+			are.NoErr(writeConn(cli, "3"+eol+"2"+eol+"1"+eol+"0"+eol))
+			r := bufio.NewReader(cli)
+			for _, s := range []string{welcomeMsg, "3" + eol, "2" + eol, "1" + eol, "0" + eol} {
+				out, err := r.ReadString('\n')
+				are.NoErr(err)
+				are.Equal(out, s) // mismatch order
+			}
+		})
+	}
+}
+
+// echoAfterSleep sleeps as many tens of milliseconds as requested then writes the message back.
+func echoAfterSleep(c *tcp.Context) {
+	b, err := c.ReadAll()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(string(b)))
+	time.Sleep(time.Duration(n) * 10 * time.Millisecond)
+	c.String(string(b))
+}
@@ -15,6 +15,16 @@ type Err interface {
 var (
 	// ErrRequest is returned if the request is invalid.
 	ErrRequest = NewError("invalid request")
+	// ErrIdleTimeout is the reason of the closing of a connection waiting too long for a new message.
+	ErrIdleTimeout = NewError("idle timeout")
+	// ErrReadTimeout is the reason of the closing of a connection taking too long to receive a message.
+	ErrReadTimeout = NewError("read timeout")
+	// ErrWriteTimeout is the reason of the closing of a connection taking too long to send a response.
+	ErrWriteTimeout = NewError("write timeout")
+	// ErrMaxLifetime is the reason of the closing of a connection open for too long.
+	ErrMaxLifetime = NewError("connection lifetime exceeded")
+	// ErrServerClosed is the reason of the closing of a connection by the closing of the server.
+	ErrServerClosed = NewError("server closed")
 )
 
 // NewError returns a new Error based of the given cause.
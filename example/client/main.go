@@ -2,39 +2,38 @@ package main
 
 import (
 	"bufio"
-	"fmt"
+	"context"
 	"log"
-	"net"
 	"os"
+
+	"github.com/rvflash/tcp/client"
 )
 
 func main() {
-	conn, err := net.Dial("tcp", ":9090")
+	c, err := client.Dial(":9090")
 	if err != nil {
 		log.Fatalf("conn: %s", err)
 	}
+	defer func() {
+		_ = c.Close()
+	}()
 	var (
 		s string
-		r *bufio.Reader
+		b []byte
+		r = bufio.NewReader(os.Stdin)
 	)
 	for {
 		// reads from stdin
 		log.Print("> ")
-		r = bufio.NewReader(os.Stdin)
 		s, err = r.ReadString('\n')
 		if err != nil {
 			log.Fatalf("read stdin: %s", err)
 		}
-		// sends it
-		_, err := fmt.Fprint(conn, s)
-		if err != nil {
-			log.Fatalf("write conn: %s", err)
-		}
-		// listens for reply
-		s, err = bufio.NewReader(conn).ReadString('\n')
+		// sends it and listens for reply
+		b, err = c.Do(context.Background(), []byte(s))
 		if err != nil {
-			log.Fatalf("read conn: %s", err)
+			log.Fatalf("call: %s", err)
 		}
-		log.Print("< " + s)
+		log.Print("< " + string(b))
 	}
 }
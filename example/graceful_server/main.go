@@ -16,7 +16,7 @@ func main() {
 	signal.Notify(bye, os.Interrupt, syscall.SIGTERM)
 
 	r := tcp.Default()
-	r.ReadTimeout = 20 * time.Second
+	r.IdleTimeout = 20 * time.Second
 	r.ACK(func(c *tcp.Context) {
 		// new message received
 		body, err := c.ReadAll()
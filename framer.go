@@ -0,0 +1,315 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+// Framer splits the stream of a connection into messages.
+// It also frames each message to send on this connection.
+type Framer interface {
+	// ReadFrame reads the next message on r.
+	ReadFrame(r *bufio.Reader) ([]byte, error)
+	// Frame returns p framed as a message, ready to be sent.
+	Frame(p []byte) ([]byte, error)
+}
+
+// List of framing errors.
+var (
+	// ErrFramer is returned if the framer is badly configured.
+	ErrFramer = NewError("invalid framer")
+	// ErrFrameSize is returned if the message size does not match the framing.
+	ErrFrameSize = NewError("invalid frame size")
+	// ErrMessageTooLarge is returned if the message exceeds the maximum size.
+	ErrMessageTooLarge = NewError("message too large")
+)
+
+// OversizePolicy defines what to do when a message exceeds the maximum size.
+type OversizePolicy int
+
+// List of supported policies.
+const (
+	// SkipMessage discards the message and continues with the next one.
+	// The message is served as an ACK segment, without body, reporting ErrMessageTooLarge in Context.Err.
+	SkipMessage OversizePolicy = iota
+	// CloseConn closes the connection, reporting ErrMessageTooLarge in the Context.Err of the FIN segment.
+	CloseConn
+)
+
+// sizeLimiter is implemented by the framers able to discard a message exceeding the maximum size,
+// without buffering it.
+type sizeLimiter interface {
+	readFrameMax(r *bufio.Reader, max int) ([]byte, error)
+}
+
+// readFrame reads the next message, limiting its size to the minimum non-zero value
+// between the MaxMessageSize of the server and the one of the framer.
+func (s *Server) readFrame(f Framer, r *bufio.Reader) ([]byte, error) {
+	if l, ok := f.(sizeLimiter); ok {
+		return l.readFrameMax(r, s.MaxMessageSize)
+	}
+	b, err := f.ReadFrame(r)
+	if err == nil && s.MaxMessageSize > 0 && len(b) > s.MaxMessageSize {
+		return nil, ErrMessageTooLarge
+	}
+	return b, err
+}
+
+// minSize returns the minimum non-zero size, or zero if both are zero.
+func minSize(a, b int) int {
+	if a <= 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+const newline = '\n'
+
+// NewLineFramer returns a framer delimiting each message by a new line.
+// It's the default framer of a server.
+func NewLineFramer() *DelimiterFramer {
+	return NewDelimiterFramer([]byte{newline})
+}
+
+// NewDelimiterFramer returns a framer delimiting each message by delim.
+// If delim is empty, the new line is used.
+func NewDelimiterFramer(delim []byte) *DelimiterFramer {
+	if len(delim) == 0 {
+		delim = []byte{newline}
+	}
+	return &DelimiterFramer{delim: delim}
+}
+
+// DelimiterFramer delimits each message by a sequence of bytes.
+// As bufio.Reader.ReadBytes does, each message read includes its delimiter.
+// Its zero value delimits each message by a new line.
+type DelimiterFramer struct {
+	// MaxSize is the maximum size of a message, delimiter included. A zero value means no limit.
+	// A message exceeding it is discarded until its delimiter, reporting ErrMessageTooLarge.
+	MaxSize int
+	delim   []byte
+}
+
+// Frame implements the Framer interface.
+// The delimiter is only added if p does not end with it.
+func (f *DelimiterFramer) Frame(p []byte) ([]byte, error) {
+	delim := f.delimiter()
+	if bytes.HasSuffix(p, delim) {
+		return p, nil
+	}
+	b := make([]byte, len(p), len(p)+len(delim))
+	copy(b, p)
+	return append(b, delim...), nil
+}
+
+// ReadFrame implements the Framer interface.
+func (f *DelimiterFramer) ReadFrame(r *bufio.Reader) ([]byte, error) {
+	return f.readFrameMax(r, 0)
+}
+
+func (f *DelimiterFramer) readFrameMax(r *bufio.Reader, max int) ([]byte, error) {
+	var (
+		delim    = f.delimiter()
+		last     = delim[len(delim)-1]
+		buf      []byte
+		tooLarge bool
+	)
+	max = minSize(max, f.MaxSize)
+	for {
+		b, err := r.ReadSlice(last)
+		buf = append(buf, b...)
+		if max > 0 && len(buf) > max {
+			// Only keeps the data required to find the delimiter.
+			tooLarge = true
+			if k := len(delim); len(buf) > k {
+				buf = append(buf[:0], buf[len(buf)-k:]...)
+			}
+		}
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err != nil && tooLarge:
+			return nil, err
+		case err != nil:
+			return buf, err
+		case !bytes.HasSuffix(buf, delim):
+			continue
+		case tooLarge:
+			return nil, ErrMessageTooLarge
+		default:
+			return buf, nil
+		}
+	}
+}
+
+// delimiter returns the delimiter of the messages, the new line by default.
+func (f *DelimiterFramer) delimiter() []byte {
+	if len(f.delim) == 0 {
+		return []byte{newline}
+	}
+	return f.delim
+}
+
+// NewFixedLengthFramer returns a framer where each message has the given size.
+func NewFixedLengthFramer(size int) *FixedLengthFramer {
+	return &FixedLengthFramer{size: size}
+}
+
+// FixedLengthFramer splits the stream into messages of the same size.
+type FixedLengthFramer struct {
+	// MaxSize is the maximum size of a message. A zero value means no limit.
+	// If the size of the messages exceeds it, each message is discarded, reporting ErrMessageTooLarge.
+	MaxSize int
+	size    int
+}
+
+// Frame implements the Framer interface.
+// The length of p must be equal to the size of a message.
+func (f *FixedLengthFramer) Frame(p []byte) ([]byte, error) {
+	if f.size <= 0 {
+		return nil, ErrFramer
+	}
+	if len(p) != f.size {
+		return nil, ErrFrameSize
+	}
+	return p, nil
+}
+
+// ReadFrame implements the Framer interface.
+func (f *FixedLengthFramer) ReadFrame(r *bufio.Reader) ([]byte, error) {
+	return f.readFrameMax(r, 0)
+}
+
+func (f *FixedLengthFramer) readFrameMax(r *bufio.Reader, max int) ([]byte, error) {
+	if f.size <= 0 {
+		return nil, ErrFramer
+	}
+	if max = minSize(max, f.MaxSize); max > 0 && f.size > max {
+		return nil, discard(r, uint64(f.size))
+	}
+	b := make([]byte, f.size)
+	_, err := io.ReadFull(r, b)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// NewLengthPrefixFramer returns a framer where each message is prefixed by its length.
+// The length is encoded on 1, 2, 4 or 8 bytes, using the given byte order.
+// By default, the big endian order is used.
+func NewLengthPrefixFramer(headerSize int, order binary.ByteOrder) *LengthPrefixFramer {
+	if order == nil {
+		order = binary.BigEndian
+	}
+	return &LengthPrefixFramer{size: headerSize, order: order}
+}
+
+// LengthPrefixFramer prefixes each message by a header containing its length.
+// The message read excludes this header.
+type LengthPrefixFramer struct {
+	// MaxSize is the maximum size of a message, header excluded. A zero value means no limit.
+	// A message exceeding it is discarded, reporting ErrMessageTooLarge.
+	MaxSize int
+	size    int
+	order   binary.ByteOrder
+}
+
+// Frame implements the Framer interface.
+func (f *LengthPrefixFramer) Frame(p []byte) ([]byte, error) {
+	limit, err := f.max()
+	if err != nil {
+		return nil, err
+	}
+	n := uint64(len(p))
+	if n > limit {
+		return nil, ErrFrameSize
+	}
+	b := make([]byte, f.size+len(p))
+	switch f.size {
+	case 1:
+		b[0] = byte(n)
+	case 2:
+		f.order.PutUint16(b, uint16(n))
+	case 4:
+		f.order.PutUint32(b, uint32(n))
+	case 8:
+		f.order.PutUint64(b, n)
+	}
+	copy(b[f.size:], p)
+	return b, nil
+}
+
+// ReadFrame implements the Framer interface.
+func (f *LengthPrefixFramer) ReadFrame(r *bufio.Reader) ([]byte, error) {
+	return f.readFrameMax(r, 0)
+}
+
+func (f *LengthPrefixFramer) readFrameMax(r *bufio.Reader, max int) ([]byte, error) {
+	if _, err := f.max(); err != nil {
+		return nil, err
+	}
+	h := make([]byte, f.size)
+	_, err := io.ReadFull(r, h)
+	if err != nil {
+		return nil, err
+	}
+	var n uint64
+	switch f.size {
+	case 1:
+		n = uint64(h[0])
+	case 2:
+		n = uint64(f.order.Uint16(h))
+	case 4:
+		n = uint64(f.order.Uint32(h))
+	case 8:
+		n = f.order.Uint64(h)
+	}
+	if max = minSize(max, f.MaxSize); max > 0 && n > uint64(max) {
+		return nil, discard(r, n)
+	}
+	if n > math.MaxInt32 {
+		return nil, ErrFrameSize
+	}
+	// The size is not trusted: the buffer only grows with the data received.
+	var buf bytes.Buffer
+	m, err := io.CopyN(&buf, r, int64(n))
+	if err != nil {
+		if err == io.EOF && m > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (f *LengthPrefixFramer) max() (uint64, error) {
+	switch f.size {
+	case 1:
+		return math.MaxUint8, nil
+	case 2:
+		return math.MaxUint16, nil
+	case 4:
+		return math.MaxUint32, nil
+	case 8:
+		return math.MaxUint64, nil
+	default:
+		return 0, ErrFramer
+	}
+}
+
+// discard skips the next n bytes, then returns ErrMessageTooLarge.
+func discard(r *bufio.Reader, n uint64) error {
+	if n > math.MaxInt64 {
+		return ErrFrameSize
+	}
+	_, err := io.CopyN(ioutil.Discard, r, int64(n))
+	if err != nil {
+		return err
+	}
+	return ErrMessageTooLarge
+}
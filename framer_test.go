@@ -0,0 +1,212 @@
+package tcp_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/rvflash/tcp"
+)
+
+func TestFramer_ReadFrame(t *testing.T) {
+	var (
+		dt = []struct {
+			f   tcp.Framer
+			in  string
+			out []string
+			err error
+		}{
+			{f: tcp.NewLineFramer(), in: "hi\nthere\n", out: []string{"hi\n", "there\n"}, err: io.EOF},
+			{f: tcp.NewDelimiterFramer(nil), in: "hi\n", out: []string{"hi\n"}, err: io.EOF},
+			{f: tcp.NewDelimiterFramer([]byte("\r\n")), in: "h\ri\r\n!\r\n", out: []string{"h\ri\r\n", "!\r\n"}, err: io.EOF},
+			{f: tcp.NewFixedLengthFramer(2), in: "hithere", out: []string{"hi", "th", "er"}, err: io.ErrUnexpectedEOF},
+			{f: tcp.NewFixedLengthFramer(0), in: "hi", err: tcp.ErrFramer},
+			{f: tcp.NewLengthPrefixFramer(1, nil), in: "\x02hi\x05there", out: []string{"hi", "there"}, err: io.EOF},
+			{f: tcp.NewLengthPrefixFramer(2, binary.BigEndian), in: "\x00\x02hi", out: []string{"hi"}, err: io.EOF},
+			{f: tcp.NewLengthPrefixFramer(2, binary.LittleEndian), in: "\x02\x00hi", out: []string{"hi"}, err: io.EOF},
+			{f: tcp.NewLengthPrefixFramer(4, nil), in: "\x00\x00\x00\x02hi", out: []string{"hi"}, err: io.EOF},
+			{f: tcp.NewLengthPrefixFramer(8, nil), in: "\x00\x00\x00\x00\x00\x00\x00\x02hi", out: []string{"hi"}, err: io.EOF},
+			{f: tcp.NewLengthPrefixFramer(3, nil), in: "\x00\x00\x02hi", err: tcp.ErrFramer},
+		}
+		are = is.New(t)
+	)
+	for i, tt := range dt {
+		tt := tt
+		t.Run("#"+strconv.Itoa(i), func(t *testing.T) {
+			var (
+				r   = bufio.NewReader(strings.NewReader(tt.in))
+				out []string
+				b   []byte
+				err error
+			)
+			for {
+				b, err = tt.f.ReadFrame(r)
+				if err != nil {
+					break
+				}
+				out = append(out, string(b))
+			}
+			are.Equal(err, tt.err) // mismatch error
+			are.Equal(out, tt.out) // mismatch messages
+		})
+	}
+}
+
+func TestFramer_MaxSize(t *testing.T) {
+	var (
+		line   = tcp.NewLineFramer()
+		crlf   = tcp.NewDelimiterFramer([]byte("\r\n"))
+		fixed  = tcp.NewFixedLengthFramer(4)
+		prefix = tcp.NewLengthPrefixFramer(1, nil)
+	)
+	line.MaxSize = 3
+	crlf.MaxSize = 4
+	fixed.MaxSize = 2
+	prefix.MaxSize = 2
+	// Limit lower than the size of the delimiter.
+	short := tcp.NewDelimiterFramer([]byte("\r\n\r\n"))
+	short.MaxSize = 2
+	// Zero value, delimited by a new line.
+	zero := &tcp.DelimiterFramer{MaxSize: 3}
+	var (
+		dt = []struct {
+			f   tcp.Framer
+			in  string
+			out []string
+			err []error
+		}{
+			{f: line, in: "hi\nhello\nyo\n", out: []string{"hi\n", "", "yo\n"}, err: []error{nil, tcp.ErrMessageTooLarge, nil, io.EOF}},
+			{f: crlf, in: "hello\r\nhi\r\n", out: []string{"", "hi\r\n"}, err: []error{tcp.ErrMessageTooLarge, nil, io.EOF}},
+			{f: short, in: "xy\nhi\r\n\r\n", out: []string{""}, err: []error{tcp.ErrMessageTooLarge, io.EOF}},
+			{f: zero, in: "hi\nhello\n", out: []string{"hi\n", ""}, err: []error{nil, tcp.ErrMessageTooLarge, io.EOF}},
+			{f: fixed, in: "hithere!", out: []string{"", ""}, err: []error{tcp.ErrMessageTooLarge, tcp.ErrMessageTooLarge, io.EOF}},
+			{f: prefix, in: "\x05there\x02hi", out: []string{"", "hi"}, err: []error{tcp.ErrMessageTooLarge, nil, io.EOF}},
+		}
+		are = is.New(t)
+	)
+	for i, tt := range dt {
+		tt := tt
+		t.Run("#"+strconv.Itoa(i), func(t *testing.T) {
+			var (
+				r    = bufio.NewReader(strings.NewReader(tt.in))
+				out  []string
+				errs []error
+			)
+			for {
+				b, err := tt.f.ReadFrame(r)
+				errs = append(errs, err)
+				if err == io.EOF {
+					break
+				}
+				out = append(out, string(b))
+			}
+			are.Equal(errs, tt.err) // mismatch errors
+			are.Equal(out, tt.out)  // mismatch messages
+		})
+	}
+}
+
+func TestFramer_Frame(t *testing.T) {
+	var (
+		dt = []struct {
+			f   tcp.Framer
+			in  string
+			out string
+			err error
+		}{
+			{f: tcp.NewLineFramer(), in: "hi", out: "hi\n"},
+			{f: tcp.NewLineFramer(), in: "hi\n", out: "hi\n"},
+			{f: tcp.NewDelimiterFramer([]byte("\r\n")), in: "hi\n", out: "hi\n\r\n"},
+			{f: &tcp.DelimiterFramer{}, in: "hi", out: "hi\n"},
+			{f: tcp.NewFixedLengthFramer(2), in: "hi", out: "hi"},
+			{f: tcp.NewFixedLengthFramer(2), in: "hello", err: tcp.ErrFrameSize},
+			{f: tcp.NewFixedLengthFramer(-1), in: "hi", err: tcp.ErrFramer},
+			{f: tcp.NewLengthPrefixFramer(1, nil), in: "hi", out: "\x02hi"},
+			{f: tcp.NewLengthPrefixFramer(1, nil), in: strings.Repeat("a", 256), err: tcp.ErrFrameSize},
+			{f: tcp.NewLengthPrefixFramer(2, binary.LittleEndian), in: "hi", out: "\x02\x00hi"},
+			{f: tcp.NewLengthPrefixFramer(4, binary.BigEndian), in: "hi", out: "\x00\x00\x00\x02hi"},
+			{f: tcp.NewLengthPrefixFramer(8, binary.LittleEndian), in: "hi", out: "\x02\x00\x00\x00\x00\x00\x00\x00hi"},
+			{f: tcp.NewLengthPrefixFramer(0, nil), in: "hi", err: tcp.ErrFramer},
+		}
+		are = is.New(t)
+	)
+	for i, tt := range dt {
+		tt := tt
+		t.Run("#"+strconv.Itoa(i), func(t *testing.T) {
+			out, err := tt.f.Frame([]byte(tt.in))
+			are.Equal(err, tt.err)         // mismatch error
+			are.Equal(string(out), tt.out) // mismatch message
+		})
+	}
+}
+
+func TestServer_MaxMessageSize(t *testing.T) {
+	const tooLargeMsg = "too large"
+	var (
+		dt = []struct {
+			addr   string
+			policy tcp.OversizePolicy
+			out    []string
+			err    error
+		}{
+			{addr: ":9141", policy: tcp.SkipMessage, out: []string{"hi" + eol, tooLargeMsg + eol, "error" + eol, "yo" + eol}},
+			{addr: ":9142", policy: tcp.CloseConn, out: []string{"hi" + eol, tooLargeMsg + eol}, err: tcp.Errors{tcp.ErrMessageTooLarge}},
+		}
+		are = is.New(t)
+	)
+	for i, tt := range dt {
+		tt := tt
+		t.Run("#"+strconv.Itoa(i), func(t *testing.T) {
+			var (
+				srv = tcp.New()
+				fin = make(chan error, 1)
+			)
+			srv.MaxMessageSize = 3
+			srv.Oversize = tt.policy
+			srv.MessageTooLargeReply = []byte(tooLargeMsg)
+			srv.Dispatch = tcp.Sequential
+			srv.ACK(func(c *tcp.Context) {
+				if c.Err() != nil {
+					c.String("error")
+					return
+				}
+				b, _ := c.ReadAll()
+				_, _ = c.Write(b)
+			})
+			srv.FIN(func(c *tcp.Context) {
+				fin <- c.Err()
+			})
+			go func() {
+				are.NoErr(srv.Run(tt.addr))
+			}()
+			time.Sleep(time.Millisecond * 100)
+
+			cli, err := net.Dial("tcp", tt.addr)
+			are.NoErr(err)
+			_, err = cli.Write([]byte("hi\nhello\nyo\n"))
+			are.NoErr(err)
+			var (
+				r   = bufio.NewReader(cli)
+				out []string
+			)
+			for range tt.out {
+				s, err := r.ReadString('\n')
+				are.NoErr(err)
+				out = append(out, s)
+			}
+			are.Equal(out, tt.out) // mismatch responses
+			if tt.err != nil {
+				_, err = r.ReadString('\n')
+				are.Equal(err, io.EOF) // expected closed connection
+			}
+			are.NoErr(cli.Close())
+			are.Equal(<-fin, tt.err) // mismatch reason
+		})
+	}
+}
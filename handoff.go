@@ -0,0 +1,259 @@
+package tcp
+
+import (
+	"crypto/tls"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// List of environment variables of the socket activation, as defined by systemd.
+const (
+	envListenFDs   = "LISTEN_FDS"
+	envListenPID   = "LISTEN_PID"
+	envListenNames = "LISTEN_FDNAMES"
+	// listenFDsStart is the first inherited file descriptor.
+	listenFDsStart = 3
+	// nameTLS is the name of an inherited listener to serve over TLS.
+	nameTLS = "tls"
+)
+
+// List of errors of the handoff of the listeners.
+var (
+	// ErrNoInheritedListener is returned by RunInherited without any inherited listener.
+	ErrNoInheritedListener = NewError("no inherited listener")
+	// ErrHandoff is returned by StartChild if a listener can not be passed to another process.
+	ErrHandoff = NewError("listener can not be handed off")
+)
+
+var inherited struct {
+	once      sync.Once
+	listeners []net.Listener
+	names     []string
+	err       error
+}
+
+// Inherited returns the listeners inherited from the parent process, by the socket activation of systemd
+// or by StartChild, in the order of their file descriptors.
+// Only the first call gets them, the next ones return the same listeners.
+// If the LISTEN_PID environment variable is set, it must be the identifier of the current process.
+func Inherited() ([]net.Listener, error) {
+	inherited.once.Do(func() {
+		inherited.listeners, inherited.names, inherited.err = listenFDs()
+	})
+	return inherited.listeners, inherited.err
+}
+
+// InheritedNames returns the names of the listeners returned by Inherited, in the same order,
+// as given by the LISTEN_FDNAMES environment variable. An unnamed listener has an empty name.
+// StartChild names "tls" the listeners served over TLS by the parent, the others by their network, like "tcp".
+func InheritedNames() []string {
+	_, _ = Inherited()
+	return inherited.names
+}
+
+func listenFDs() ([]net.Listener, []string, error) {
+	if pid := os.Getenv(envListenPID); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		// Not for this process.
+		return nil, nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv(envListenFDs))
+	if err != nil || n <= 0 {
+		return nil, nil, nil
+	}
+	names := make([]string, n)
+	if s := os.Getenv(envListenNames); s != "" {
+		copy(names, strings.Split(s, ":"))
+	}
+	// The child processes must not inherit them.
+	for _, key := range []string{envListenFDs, envListenPID, envListenNames} {
+		_ = os.Unsetenv(key)
+	}
+	ls := make([]net.Listener, 0, n)
+	for fd := listenFDsStart; fd < listenFDsStart+n; fd++ {
+		f := os.NewFile(uintptr(fd), "listener"+strconv.Itoa(fd))
+		l, err := net.FileListener(f)
+		_ = f.Close()
+		if err != nil {
+			return ls, names[:len(ls)], err
+		}
+		ls = append(ls, l)
+	}
+	return ls, names, nil
+}
+
+// RunInherited serves all the listeners inherited from the parent process, see Inherited.
+// The listeners named "tls", as the ones served by RunTLS in the parent, are served over TLS
+// with the TLSConfig of the server. Without any certificate in it, ErrTLSConfig is returned.
+// This method will block the calling goroutine indefinitely unless an error happens.
+func (s *Server) RunInherited() error {
+	ls, err := Inherited()
+	if err != nil {
+		return err
+	}
+	if len(ls) == 0 {
+		return ErrNoInheritedListener
+	}
+	names := InheritedNames()
+	wrapped := make([]net.Listener, len(ls))
+	for i, l := range ls {
+		wrapped[i] = l
+		if names[i] != nameTLS {
+			continue
+		}
+		c, err := s.tlsConfig("", "")
+		if err != nil {
+			return err
+		}
+		if !hasCertificate(c) {
+			// Never serves it in plaintext.
+			return ErrTLSConfig
+		}
+		wrapped[i] = tls.NewListener(l, c)
+	}
+	var (
+		w8   sync.WaitGroup
+		once sync.Once
+	)
+	for i := range ls {
+		w8.Add(1)
+		go func(l, raw net.Listener) {
+			defer w8.Done()
+			// Keeps the raw listener to be able to hand it off again.
+			if e := s.serve(l, raw); e != nil {
+				once.Do(func() {
+					err = e
+				})
+			}
+		}(wrapped[i], ls[i])
+	}
+	w8.Wait()
+	return err
+}
+
+type filer interface {
+	File() (*os.File, error)
+}
+
+// StartChild starts a child process with the listening sockets of the server,
+// for a restart without downtime. The child gets them with Inherited or RunInherited,
+// then the parent shuts down the server with Shutdown, ideally with Drain.
+// If cmd is nil, the current executable is started with the same arguments, environment and standard outputs.
+// The listeners are passed as the first extra files, with the LISTEN_FDS environment variable,
+// so cmd must not have any ExtraFiles, otherwise ErrHandoff is returned.
+// The LISTEN_FDNAMES environment variable names "tls" the listeners served over TLS, see InheritedNames.
+// Once the child started, the Unix domain sockets are no more removed on the closing of the listeners of the parent.
+func (s *Server) StartChild(cmd *exec.Cmd) error {
+	files, names, uls, err := s.listenerFiles()
+	if err != nil {
+		return err
+	}
+	// The child has its own copy of them.
+	defer closeFiles(files)
+	if cmd == nil {
+		cmd, err = selfCommand()
+		if err != nil {
+			return err
+		}
+	}
+	if len(cmd.ExtraFiles) > 0 {
+		// The inherited file descriptors must be the first ones.
+		return ErrHandoff
+	}
+	cmd.ExtraFiles = files
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	cmd.Env = append(withoutListenEnv(env),
+		envListenFDs+"="+strconv.Itoa(len(files)),
+		envListenNames+"="+strings.Join(names, ":"),
+	)
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+	// The child now uses their paths.
+	for _, ul := range uls {
+		ul.SetUnlinkOnClose(false)
+	}
+	return nil
+}
+
+// listenerFiles returns a copy of the file of each raw listener, sorted by address, with their names
+// and the listeners of Unix domain sockets among them.
+func (s *Server) listenerFiles() ([]*os.File, []string, []*net.UnixListener, error) {
+	s.lnmu.Lock()
+	ls := make([][2]net.Listener, 0, len(s.listeners))
+	for l, raw := range s.listeners {
+		ls = append(ls, [2]net.Listener{l, raw})
+	}
+	s.lnmu.Unlock()
+	sort.Slice(ls, func(i, j int) bool {
+		return ls[i][1].Addr().String() < ls[j][1].Addr().String()
+	})
+	var (
+		files = make([]*os.File, 0, len(ls))
+		names = make([]string, 0, len(ls))
+		uls   []*net.UnixListener
+	)
+	for _, p := range ls {
+		l, raw := p[0], p[1]
+		fl, ok := raw.(filer)
+		if !ok {
+			closeFiles(files)
+			return nil, nil, nil, ErrHandoff
+		}
+		f, err := fl.File()
+		if err != nil {
+			closeFiles(files)
+			return nil, nil, nil, err
+		}
+		files = append(files, f)
+		if l != raw {
+			// Served over TLS.
+			names = append(names, nameTLS)
+		} else {
+			names = append(names, raw.Addr().Network())
+		}
+		if ul, ok := raw.(*net.UnixListener); ok {
+			uls = append(uls, ul)
+		}
+	}
+	return files, names, uls, nil
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		_ = f.Close()
+	}
+}
+
+func selfCommand() (*exec.Cmd, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+func withoutListenEnv(env []string) []string {
+	res := make([]string, 0, len(env))
+	for _, kv := range env {
+		if strings.HasPrefix(kv, envListenFDs+"=") ||
+			strings.HasPrefix(kv, envListenPID+"=") ||
+			strings.HasPrefix(kv, envListenNames+"=") {
+			continue
+		}
+		res = append(res, kv)
+	}
+	return res
+}
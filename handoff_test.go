@@ -0,0 +1,102 @@
+package tcp_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/rvflash/tcp"
+)
+
+const envHandoffChild = "TCP_HANDOFF_CHILD"
+
+func TestServer_RunInherited(t *testing.T) {
+	are := is.New(t)
+	if os.Getenv(envHandoffChild) == "" {
+		are.Equal(tcp.New().RunInherited(), tcp.ErrNoInheritedListener) // expected no listener
+		return
+	}
+	// Child process: serves one connection by listener, then exits.
+	_, err := tcp.Inherited()
+	are.NoErr(err)
+	are.Equal(tcp.InheritedNames(), []string{"tcp", "tls"}) // mismatch names
+	srv := tcp.New()
+	are.Equal(srv.RunInherited(), tcp.ErrTLSConfig) // expected no plaintext on the TLS listener
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	are.NoErr(err)
+	var n int32
+	srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	srv.SYN(func(c *tcp.Context) {
+		c.String("child " + strconv.FormatBool(c.Request.TLS != nil))
+	})
+	srv.FIN(func(c *tcp.Context) {
+		if atomic.AddInt32(&n, 1) == 2 {
+			go func() {
+				_ = srv.Close()
+			}()
+		}
+	})
+	are.NoErr(srv.RunInherited())
+}
+
+func TestServer_StartChild(t *testing.T) {
+	const (
+		addr    = ":9152"
+		tlsAddr = ":9158"
+	)
+	var (
+		are = is.New(t)
+		srv = tcp.New()
+	)
+	srv.SYN(func(c *tcp.Context) {
+		c.String("parent")
+	})
+	go func() {
+		are.NoErr(srv.Run(addr))
+	}()
+	go func() {
+		are.NoErr(srv.RunTLS(tlsAddr, certFile, keyFile))
+	}()
+	time.Sleep(time.Millisecond * 100)
+	are.Equal(greeting(t, addr), "parent"+eol) // mismatch server
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestServer_RunInherited$")
+	cmd.ExtraFiles = []*os.File{os.Stdin}
+	are.Equal(srv.StartChild(cmd), tcp.ErrHandoff) // mismatch error with extra files
+
+	cmd = exec.Command(os.Args[0], "-test.run=^TestServer_RunInherited$")
+	cmd.Env = append(os.Environ(), envHandoffChild+"=1")
+	are.NoErr(srv.StartChild(cmd))
+	are.NoErr(srv.Shutdown(context.Background()))
+
+	// The child accepts the next connections on the same sockets, the TLS one still over TLS.
+	are.Equal(greeting(t, addr), "child false"+eol) // mismatch server
+	tc, err := tls.Dial("tcp", tlsAddr, &tls.Config{InsecureSkipVerify: true})
+	are.NoErr(err)
+	out, err := bufio.NewReader(tc).ReadString('\n')
+	are.NoErr(err)
+	are.Equal(out, "child true"+eol) // mismatch TLS server
+	are.NoErr(tc.Close())
+	are.NoErr(cmd.Wait())
+}
+
+func greeting(t *testing.T, addr string) string {
+	are := is.New(t)
+	cli, err := net.Dial("tcp", addr)
+	are.NoErr(err)
+	defer func() {
+		are.NoErr(cli.Close())
+	}()
+	out, err := bufio.NewReader(cli).ReadString('\n')
+	are.NoErr(err)
+	return out
+}
@@ -0,0 +1,77 @@
+package tcp
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// List of hijacking errors.
+var (
+	// ErrHijacked is returned when the connection has been hijacked by a handler.
+	ErrHijacked = NewError("connection hijacked")
+	// ErrHijackUnsupported is returned by Hijack if the server does not use the Sequential dispatch mode.
+	ErrHijackUnsupported = NewError("hijack requires the sequential dispatch")
+)
+
+// errHijacked is returned when the reading is stopped by the hijacking of the connection.
+var errHijacked = errors.New("hijacked")
+
+// Hijack lets the handler take over the connection, as the http.Hijacker does.
+// The response written so far is flushed, then the server stops reading the messages of the connection
+// and no more tracks it for its timeouts, its shutdown, its registry or its topics.
+// The FIN segment is not served. The returned bufio.ReadWriter contains any data already received
+// and not yet read. Once hijacked, the connection must be closed by the handler.
+// It requires the Sequential dispatch mode, otherwise ErrHijackUnsupported is returned:
+// with the other modes, the server keeps reading the next messages in the meantime.
+func (c *Context) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if c.Request == nil || c.Request.conn == nil {
+		return nil, nil, ErrRequest
+	}
+	if c.Request.conn.srv.Dispatch != Sequential {
+		return nil, nil, ErrHijackUnsupported
+	}
+	_ = c.writer.Flush()
+	return c.Request.conn.hijack()
+}
+
+// hijack stops the reading of the messages, then untracks the connection.
+func (c *conn) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	c.umu.Lock()
+	defer c.umu.Unlock()
+	if c.hijacked() {
+		return nil, nil, ErrHijacked
+	}
+	if st := ConnState(atomic.LoadInt32(&c.state)); st == StateClosing || st == StateClosed {
+		// No more reading.
+		return nil, nil, ErrRequest
+	}
+	// Interrupts the reading of the next message.
+	atomic.StoreInt32(&c.pausing, 1)
+	defer atomic.StoreInt32(&c.pausing, 0)
+	rwc := c.netConn()
+	_ = rwc.SetReadDeadline(aLongTimeAgo)
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	atomic.StoreInt32(&c.hijacking, 1)
+	c.setState(StateHijacked)
+	// The handler gets its full ownership.
+	err := rwc.SetDeadline(time.Time{})
+	if err != nil {
+		return nil, nil, err
+	}
+	c.srv.trackConn(c, false)
+	c.srv.leaveAll(c)
+	c.srv.doneConn(c)
+	return rwc, bufio.NewReadWriter(c.br, bufio.NewWriter(rwc)), nil
+}
+
+// hijacked returns true if the connection has been hijacked.
+func (c *conn) hijacked() bool {
+	return atomic.LoadInt32(&c.hijacking) == 1
+}
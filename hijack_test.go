@@ -0,0 +1,158 @@
+package tcp_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/rvflash/tcp"
+)
+
+func TestContext_Hijack(t *testing.T) {
+	const (
+		addr = ":9154"
+		bulk = "\x00\x01\x02\x03"
+	)
+	var (
+		are = is.New(t)
+		srv = tcp.New()
+		fin = make(chan struct{}, 1)
+	)
+	srv.Dispatch = tcp.Sequential
+	srv.Command("BULK", func(c *tcp.Context) {
+		c.String("go")
+		conn, rw, err := c.Hijack()
+		are.NoErr(err)
+		defer func() {
+			are.NoErr(conn.Close())
+		}()
+		_, _, err = c.Hijack()
+		are.Equal(err, tcp.ErrHijacked) // expected already hijacked
+		_, ok := srv.Conn(c.Conn().ID())
+		are.True(!ok) // expected untracked connection
+
+		b := make([]byte, len(bulk))
+		_, err = io.ReadFull(rw, b)
+		are.NoErr(err)
+		_, err = rw.WriteString("got " + strconv.Itoa(len(b)) + eol)
+		are.NoErr(err)
+		are.NoErr(rw.Flush())
+	})
+	srv.FIN(func(c *tcp.Context) {
+		fin <- struct{}{}
+	})
+	go func() {
+		are.NoErr(srv.Run(addr))
+	}()
+	time.Sleep(time.Millisecond * 100)
+
+	cli, err := net.Dial("tcp", addr)
+	are.NoErr(err)
+	defer func() {
+		_ = cli.Close()
+	}()
+	r := bufio.NewReader(cli)
+	// The data received after the command are given to the handler.
+	are.NoErr(writeConn(cli, "BULK"+eol+bulk))
+	out, err := r.ReadString('\n')
+	are.NoErr(err)
+	are.Equal(out, "go"+eol) // mismatch response
+	// The server no more waits for the hijacked connection.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	are.NoErr(srv.Shutdown(ctx))
+
+	out, err = r.ReadString('\n')
+	are.NoErr(err)
+	are.Equal(out, "got 4"+eol) // mismatch hijacked response
+	_, err = r.ReadString('\n')
+	are.Equal(err, io.EOF) // expected closed connection
+	select {
+	case <-fin:
+		t.Fatal("unexpected FIN segment")
+	default:
+	}
+}
+
+func TestContext_Hijack2(t *testing.T) {
+	const addr = ":9157"
+	var (
+		are = is.New(t)
+		srv = tcp.New()
+	)
+	srv.Dispatch = tcp.Sequential
+	srv.SYN(func(c *tcp.Context) {
+		conn, rw, err := c.Hijack()
+		are.NoErr(err)
+		defer func() {
+			are.NoErr(conn.Close())
+		}()
+		s, err := rw.ReadString('\n')
+		are.NoErr(err)
+		_, err = rw.WriteString("got " + s)
+		are.NoErr(err)
+		are.NoErr(rw.Flush())
+	})
+	go func() {
+		are.NoErr(srv.Run(addr))
+	}()
+	time.Sleep(time.Millisecond * 100)
+
+	cli, err := net.Dial("tcp", addr)
+	are.NoErr(err)
+	defer func() {
+		_ = cli.Close()
+	}()
+	// Hijacked as soon as the connection is accepted.
+	are.NoErr(writeConn(cli, "hi"+eol))
+	r := bufio.NewReader(cli)
+	out, err := r.ReadString('\n')
+	are.NoErr(err)
+	are.Equal(out, "got hi"+eol) // mismatch hijacked response
+	_, err = r.ReadString('\n')
+	are.Equal(err, io.EOF) // expected closed connection
+}
+
+func TestContext_Hijack3(t *testing.T) {
+	var (
+		dt = []struct {
+			addr string
+			mode tcp.DispatchMode
+		}{
+			{addr: ":9155", mode: tcp.Concurrent},
+			{addr: ":9159", mode: tcp.Pipelined},
+		}
+		are = is.New(t)
+	)
+	for i, tt := range dt {
+		tt := tt
+		t.Run("#"+strconv.Itoa(i), func(t *testing.T) {
+			srv := tcp.New()
+			srv.Dispatch = tt.mode
+			srv.ACK(func(c *tcp.Context) {
+				_, _, err := c.Hijack()
+				are.Equal(err, tcp.ErrHijackUnsupported) // expected unsupported dispatch mode
+				c.String("served")
+			})
+			go func() {
+				are.NoErr(srv.Run(tt.addr))
+			}()
+			time.Sleep(time.Millisecond * 100)
+
+			cli, err := net.Dial("tcp", tt.addr)
+			are.NoErr(err)
+			defer func() {
+				_ = cli.Close()
+			}()
+			are.NoErr(writeConn(cli, "hi"+eol))
+			out, err := bufio.NewReader(cli).ReadString('\n')
+			are.NoErr(err)
+			are.Equal(out, "served"+eol) // mismatch response
+		})
+	}
+}
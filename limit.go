@@ -0,0 +1,148 @@
+package tcp
+
+import (
+	"context"
+	"net"
+)
+
+// OverflowPolicy defines what to do with a new connection when a limit of connections is reached.
+type OverflowPolicy int
+
+// List of supported policies.
+const (
+	// Reject closes the new connection, after writing the RejectMessage of the server, if any.
+	Reject OverflowPolicy = iota
+	// Wait blocks until a slot frees.
+	// With MaxConns, the server stops accepting new connections.
+	// With MaxConnsPerIP, the new connection waits before its SYN segment.
+	Wait
+)
+
+// List of errors reporting a limit of connections.
+var (
+	// ErrTooManyConns is the reason of the rejection of a connection when MaxConns is reached.
+	ErrTooManyConns = NewError("too many connections")
+	// ErrTooManyConnsPerIP is the reason of the rejection of a connection when MaxConnsPerIP is reached.
+	ErrTooManyConnsPerIP = NewError("too many connections from this address")
+)
+
+// waitConnSlot blocks until the number of connections is under MaxConns.
+// It only applies with the Wait policy.
+func (s *Server) waitConnSlot(ctx context.Context) error {
+	if s.MaxConns <= 0 || s.Overflow != Wait {
+		return nil
+	}
+	return s.waitSlot(ctx, func() bool {
+		return s.numConns < s.MaxConns
+	})
+}
+
+// acquireConn reserves a slot for the connection accepted, returning the reason of its rejection, if any.
+// With the Wait policy, it blocks until a slot frees, as another listener may have taken the last one.
+func (s *Server) acquireConn(ctx context.Context, c *conn) error {
+	acquire := func() bool {
+		if s.MaxConns > 0 && s.numConns >= s.MaxConns {
+			return false
+		}
+		s.numConns++
+		return true
+	}
+	if s.Overflow == Wait {
+		if err := s.waitSlot(ctx, acquire); err != nil {
+			return ErrServerClosed
+		}
+		return nil
+	}
+	s.lmu.Lock()
+	defer s.lmu.Unlock()
+	if !acquire() {
+		return ErrTooManyConns
+	}
+	return nil
+}
+
+// acquireConnPerIP reserves a slot for the remote address of the connection,
+// returning the reason of its rejection, if any.
+func (s *Server) acquireConnPerIP(ctx context.Context, c *conn) error {
+	if s.MaxConnsPerIP <= 0 {
+		return nil
+	}
+	ip := remoteIP(c.addr)
+	acquire := func() bool {
+		if s.numConnsPerIP[ip] >= s.MaxConnsPerIP {
+			return false
+		}
+		s.numConnsPerIP[ip]++
+		c.ip = ip
+		return true
+	}
+	if s.Overflow == Wait {
+		return s.waitSlot(ctx, acquire)
+	}
+	s.lmu.Lock()
+	defer s.lmu.Unlock()
+	if !acquire() {
+		return ErrTooManyConnsPerIP
+	}
+	return nil
+}
+
+// releaseConn frees the slots of the connection.
+func (s *Server) releaseConn(c *conn) {
+	s.lmu.Lock()
+	s.numConns--
+	if c.ip != "" {
+		s.numConnsPerIP[c.ip]--
+		if s.numConnsPerIP[c.ip] <= 0 {
+			delete(s.numConnsPerIP, c.ip)
+		}
+	}
+	// Wakes up the waiting connections.
+	close(s.released)
+	s.released = make(chan struct{})
+	s.lmu.Unlock()
+}
+
+// waitSlot blocks until ok returns true or the context is done.
+// ok is called with the lock held, so it can reserve the slot before any other connection takes it.
+func (s *Server) waitSlot(ctx context.Context, ok func() bool) error {
+	s.lmu.Lock()
+	for !ok() {
+		released := s.released
+		s.lmu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-released:
+		}
+		s.lmu.Lock()
+	}
+	s.lmu.Unlock()
+	return nil
+}
+
+// reject closes the connection for the given reason.
+// The rejection is served as a FIN segment, without SYN, reporting the reason in Context.Err.
+func (c *conn) reject(ctx context.Context, reason error) {
+	if len(c.srv.RejectMessage) > 0 {
+		_ = c.Send(c.srv.RejectMessage)
+	}
+	c.abort(ctx, reason)
+}
+
+// abort closes the connection before serving it.
+// It's served as a FIN segment, without SYN, reporting the reason in Context.Err.
+func (c *conn) abort(ctx context.Context, reason error) {
+	c.setState(StateClosing)
+	c.bySegment(ctx, FIN, frame{err: reason})
+	_ = c.Close()
+	c.setState(StateClosed)
+}
+
+func remoteIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
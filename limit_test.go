@@ -0,0 +1,124 @@
+package tcp_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/rvflash/tcp"
+)
+
+func TestServer_MaxConns(t *testing.T) {
+	const busyMsg = "busy"
+	var (
+		dt = []struct {
+			addr string
+			max,
+			maxPerIP int
+			err error
+		}{
+			{addr: ":9137", max: 1, err: tcp.ErrTooManyConns},
+			{addr: ":9138", maxPerIP: 1, err: tcp.ErrTooManyConnsPerIP},
+		}
+		are = is.New(t)
+	)
+	for i, tt := range dt {
+		tt := tt
+		t.Run("#"+strconv.Itoa(i), func(t *testing.T) {
+			var (
+				srv = tcp.New()
+				fin = make(chan error, 1)
+			)
+			srv.MaxConns = tt.max
+			srv.MaxConnsPerIP = tt.maxPerIP
+			srv.RejectMessage = []byte(busyMsg)
+			srv.SYN(welcome)
+			srv.FIN(func(c *tcp.Context) {
+				fin <- c.Err()
+			})
+			go func() {
+				are.NoErr(srv.Run(tt.addr))
+			}()
+			time.Sleep(time.Millisecond * 100)
+
+			// First connection
+			cli, err := net.Dial("tcp", tt.addr)
+			are.NoErr(err)
+			out, err := bufio.NewReader(cli).ReadString('\n')
+			are.NoErr(err)
+			are.Equal(out, welcomeMsg) // expected accepted connection
+			// Rejected connection
+			rej, err := net.Dial("tcp", tt.addr)
+			are.NoErr(err)
+			r := bufio.NewReader(rej)
+			out, err = r.ReadString('\n')
+			are.NoErr(err)
+			are.Equal(out, busyMsg+eol) // expected rejected connection
+			_, err = r.ReadString('\n')
+			are.Equal(err, io.EOF)               // expected closed connection
+			are.Equal(<-fin, tcp.Errors{tt.err}) // mismatch reason
+			are.NoErr(rej.Close())
+			// Frees the slot.
+			are.NoErr(cli.Close())
+			are.Equal(<-fin, nil)
+			cli, err = net.Dial("tcp", tt.addr)
+			are.NoErr(err)
+			out, err = bufio.NewReader(cli).ReadString('\n')
+			are.NoErr(err)
+			are.Equal(out, welcomeMsg) // expected accepted connection
+			are.NoErr(cli.Close())
+		})
+	}
+}
+
+func TestServer_Overflow(t *testing.T) {
+	var (
+		dt = []struct {
+			addr string
+			max,
+			maxPerIP int
+		}{
+			{addr: ":9139", max: 1},
+			{addr: ":9140", maxPerIP: 1},
+		}
+		are = is.New(t)
+	)
+	for i, tt := range dt {
+		tt := tt
+		t.Run("#"+strconv.Itoa(i), func(t *testing.T) {
+			srv := tcp.New()
+			srv.MaxConns = tt.max
+			srv.MaxConnsPerIP = tt.maxPerIP
+			srv.Overflow = tcp.Wait
+			srv.SYN(welcome)
+			go func() {
+				are.NoErr(srv.Run(tt.addr))
+			}()
+			time.Sleep(time.Millisecond * 100)
+
+			first, err := net.Dial("tcp", tt.addr)
+			are.NoErr(err)
+			out, err := bufio.NewReader(first).ReadString('\n')
+			are.NoErr(err)
+			are.Equal(out, welcomeMsg) // expected accepted connection
+			// The second connection waits for the closing of the first one.
+			second, err := net.Dial("tcp", tt.addr)
+			are.NoErr(err)
+			defer func() {
+				are.NoErr(second.Close())
+			}()
+			are.NoErr(second.SetReadDeadline(time.Now().Add(50 * time.Millisecond)))
+			_, err = bufio.NewReader(second).ReadString('\n')
+			are.True(err != nil) // expected timeout
+			are.NoErr(first.Close())
+			are.NoErr(second.SetReadDeadline(time.Now().Add(time.Second)))
+			out, err = bufio.NewReader(second).ReadString('\n')
+			are.NoErr(err)
+			are.Equal(out, welcomeMsg) // expected accepted connection
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package tcp
+
+// SlowConsumerPolicy defines what to do when the outbound queue of a connection is full.
+type SlowConsumerPolicy int
+
+// List of supported policies.
+const (
+	// DropMessage drops the message published to a connection with a full outbound queue.
+	DropMessage SlowConsumerPolicy = iota
+	// Disconnect closes the connection with a full outbound queue.
+	Disconnect
+)
+
+// ErrSlowConsumer is the reason of the closing of a connection with a full outbound queue.
+var ErrSlowConsumer = NewError("slow consumer")
+
+const defaultOutboundQueueSize = 64
+
+// Publish sends the message, framed by the Framer of the server, to each connection subscribed to the topic.
+// It never blocks: the message is queued on each connection, applying the SlowConsumer policy
+// if the outbound queue of one of them is full.
+// It returns the number of connections on which the message was queued.
+func (s *Server) Publish(topic string, msg []byte) (int, error) {
+	b, err := s.framer().Frame(msg)
+	if err != nil {
+		return 0, err
+	}
+	s.tmu.RLock()
+	conns := make([]*conn, 0, len(s.topics[topic]))
+	for c := range s.topics[topic] {
+		conns = append(conns, c)
+	}
+	s.tmu.RUnlock()
+
+	var n int
+	for _, c := range conns {
+		if c.push(b) {
+			n++
+			continue
+		}
+		if s.SlowConsumer == Disconnect {
+			c.setErr(ErrSlowConsumer)
+			_ = c.Close()
+		}
+	}
+	return n, nil
+}
+
+func (s *Server) join(c *conn, topic string) {
+	c.startPush()
+	s.tmu.Lock()
+	if s.topics[topic] == nil {
+		s.topics[topic] = make(map[*conn]struct{})
+	}
+	s.topics[topic][c] = struct{}{}
+	s.tmu.Unlock()
+}
+
+func (s *Server) leave(c *conn, topic string) {
+	s.tmu.Lock()
+	delete(s.topics[topic], c)
+	if len(s.topics[topic]) == 0 {
+		delete(s.topics, topic)
+	}
+	s.tmu.Unlock()
+}
+
+// leaveAll unsubscribes the connection from all its topics.
+func (s *Server) leaveAll(c *conn) {
+	s.tmu.Lock()
+	for topic, conns := range s.topics {
+		delete(conns, c)
+		if len(conns) == 0 {
+			delete(s.topics, topic)
+		}
+	}
+	s.tmu.Unlock()
+}
+
+func (s *Server) outboundQueueSize() int {
+	if s.OutboundQueueSize <= 0 {
+		return defaultOutboundQueueSize
+	}
+	return s.OutboundQueueSize
+}
+
+// startPush starts writing the messages of the outbound queue on the connection.
+func (c *conn) startPush() {
+	c.outOnce.Do(func() {
+		c.out = make(chan []byte, c.srv.outboundQueueSize())
+		go func() {
+			for {
+				select {
+				case b := <-c.out:
+					_ = c.writeMessage(b)
+				case <-c.done:
+					return
+				}
+			}
+		}()
+	})
+}
+
+// push queues the framed message without blocking.
+// It returns false if the outbound queue is full.
+func (c *conn) push(b []byte) bool {
+	select {
+	case c.out <- b:
+		return true
+	default:
+		return false
+	}
+}
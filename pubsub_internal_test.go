@@ -0,0 +1,37 @@
+package tcp
+
+import (
+	"net"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestServer_Publish(t *testing.T) {
+	var (
+		are      = is.New(t)
+		srv      = New()
+		cli, rwc = net.Pipe()
+	)
+	defer func() {
+		_ = cli.Close()
+	}()
+	srv.OutboundQueueSize = 1
+	srv.SlowConsumer = Disconnect
+	c := srv.newConn(rwc, nil)
+	srv.join(c, "room")
+	defer close(c.done)
+
+	// Nobody reads the messages: the first one is blocked in writing, the second one is queued.
+	n, err := srv.Publish("room", []byte(msg))
+	are.NoErr(err)
+	are.Equal(n, 1)
+	for i := 0; i < 3 && n > 0; i++ {
+		n, err = srv.Publish("room", []byte(msg))
+		are.NoErr(err)
+	}
+	are.Equal(n, 0)                        // expected full queue
+	are.Equal(c.reason(), ErrSlowConsumer) // mismatch reason
+	_, err = cli.Read(make([]byte, 1))
+	are.True(err != nil) // expected closed connection
+}
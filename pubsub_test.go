@@ -0,0 +1,87 @@
+package tcp_test
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/rvflash/tcp"
+)
+
+func TestServer_Publish(t *testing.T) {
+	const (
+		addr  = ":9136"
+		topic = "room"
+		news  = "news"
+	)
+	var (
+		are = is.New(t)
+		srv = tcp.New()
+		ack = make(chan struct{})
+		fin = make(chan struct{})
+	)
+	srv.Dispatch = tcp.Sequential
+	srv.Command("JOIN", func(c *tcp.Context) {
+		are.NoErr(c.Join(c.Args()[0]))
+		ack <- struct{}{}
+	})
+	srv.Command("LEAVE", func(c *tcp.Context) {
+		are.NoErr(c.Leave(c.Args()[0]))
+		ack <- struct{}{}
+	})
+	srv.FIN(func(c *tcp.Context) {
+		fin <- struct{}{}
+	})
+	go func() {
+		are.NoErr(srv.Run(addr))
+	}()
+	time.Sleep(time.Millisecond * 100)
+
+	var (
+		clients [2]net.Conn
+		readers [2]*bufio.Reader
+	)
+	for i := range clients {
+		cli, err := net.Dial("tcp", addr)
+		are.NoErr(err)
+		clients[i], readers[i] = cli, bufio.NewReader(cli)
+		are.NoErr(writeConn(cli, "JOIN "+topic+eol))
+		<-ack
+	}
+	n, err := srv.Publish(topic, []byte(news))
+	are.NoErr(err)
+	are.Equal(n, len(clients)) // mismatch subscribers
+	for _, r := range readers {
+		out, err := r.ReadString('\n')
+		are.NoErr(err)
+		are.Equal(out, news+eol) // mismatch message
+	}
+	// Unknown topic
+	n, err = srv.Publish("unknown", []byte(news))
+	are.NoErr(err)
+	are.Equal(n, 0) // expected no subscriber
+	// Explicit leaving
+	are.NoErr(writeConn(clients[0], "LEAVE "+topic+eol))
+	<-ack
+	n, err = srv.Publish(topic, []byte(news))
+	are.NoErr(err)
+	are.Equal(n, 1) // mismatch subscribers
+	// Automatic leaving on FIN
+	are.NoErr(clients[1].Close())
+	<-fin
+	n, err = srv.Publish(topic, []byte(news))
+	are.NoErr(err)
+	are.Equal(n, 0) // expected no more subscriber
+	_ = clients[0].Close()
+}
+
+func TestContext_Join(t *testing.T) {
+	var (
+		are = is.New(t)
+		c   = newContext(newDefaultRequest())
+	)
+	are.Equal(c.Join("room"), tcp.ErrRequest)
+	are.Equal(c.Leave("room"), tcp.ErrRequest)
+}
@@ -0,0 +1,229 @@
+package tcp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is reported when a message exceeds the rate limit.
+var ErrRateLimited = NewError("rate limit exceeded")
+
+// LimitAction defines what to do with a message exceeding the rate limit.
+type LimitAction int
+
+// List of supported actions.
+const (
+	// LimitDelay waits until the message is allowed, then handles it.
+	LimitDelay LimitAction = iota
+	// LimitDrop ignores the message: the pending handlers are not called.
+	LimitDrop
+	// LimitReply writes the Reply of the RateLimit then ignores the message.
+	LimitReply
+	// LimitClose closes the connection.
+	LimitClose
+)
+
+// RateLimit defines the limits applied by the RateLimiter middleware.
+type RateLimit struct {
+	// Messages is the number of messages allowed per second. A zero value means no limit.
+	Messages float64
+	// Burst is the maximum number of messages allowed at once.
+	// If zero, it's the number of messages allowed per second, at least one.
+	Burst int
+	// Bytes is the number of bytes allowed per second. A zero value means no limit.
+	Bytes float64
+	// BurstBytes is the maximum number of bytes allowed at once.
+	// If zero, it's the number of bytes allowed per second.
+	// Unless it's delayed, a message larger than it is never allowed.
+	BurstBytes int
+	// Key returns the key on which the limits apply. If nil, KeyByConn is used.
+	Key func(*Context) string
+	// Action defines what to do with a message exceeding the limits. By default, the message is delayed.
+	Action LimitAction
+	// Reply is the message written with the LimitReply action.
+	Reply []byte
+}
+
+// KeyByConn applies the limits by connection.
+func KeyByConn(c *Context) string {
+	if cn := c.Conn(); cn != nil {
+		return strconv.FormatUint(cn.ID(), 10)
+	}
+	if c.Request == nil {
+		return ""
+	}
+	return c.Request.RemoteAddr
+}
+
+// KeyByIP applies the limits by remote IP address.
+func KeyByIP(c *Context) string {
+	if c.Request == nil {
+		return ""
+	}
+	return remoteIP(c.Request.RemoteAddr)
+}
+
+// RateLimiter returns a middleware limiting the number of messages and bytes received per second.
+// It only applies on the ACK segments. Each message exceeding the limits reports ErrRateLimited.
+func RateLimiter(limit RateLimit) HandlerFunc {
+	if limit.Key == nil {
+		limit.Key = KeyByConn
+	}
+	if limit.Burst <= 0 {
+		limit.Burst = int(math.Max(1, math.Ceil(limit.Messages)))
+	}
+	if limit.BurstBytes <= 0 {
+		limit.BurstBytes = int(math.Ceil(limit.Bytes))
+	}
+	l := &limiter{
+		limit:   limit,
+		buckets: make(map[string]*buckets),
+	}
+	return func(c *Context) {
+		if c.Request == nil || c.Request.Segment != ACK {
+			c.Next()
+			return
+		}
+		wait, ok := l.reserve(l.limit.Key(c), requestSize(c.Request), time.Now())
+		if wait == 0 && ok {
+			c.Next()
+			return
+		}
+		c.Error(ErrRateLimited)
+		switch l.limit.Action {
+		case LimitDelay:
+			select {
+			case <-time.After(wait):
+				c.Next()
+			case <-c.Canceled():
+				c.Abort()
+			}
+		case LimitReply:
+			c.String(string(l.limit.Reply))
+			c.Abort()
+		case LimitClose:
+			if err := c.Close(); err != nil {
+				c.Error(err)
+			}
+			c.Abort()
+		default:
+			c.Abort()
+		}
+	}
+}
+
+// requestSize returns the size of the body of the request, which remains readable.
+func requestSize(req *Request) int {
+	if req.Body == nil {
+		return 0
+	}
+	buf, _ := ioutil.ReadAll(req.Body)
+	req.Body = ioutil.NopCloser(bytes.NewReader(buf))
+	return len(buf)
+}
+
+const sweepPeriod = time.Minute
+
+type limiter struct {
+	limit RateLimit
+
+	mu      sync.Mutex
+	buckets map[string]*buckets
+	swept   time.Time
+}
+
+// buckets contains the token buckets of a key.
+type buckets struct {
+	messages,
+	bytes bucket
+	last time.Time
+}
+
+type bucket struct {
+	tokens float64
+}
+
+// reserve returns the duration to wait before handling the message and whether it's allowed.
+// With the LimitDelay action, the message is always allowed, the tokens are consumed in advance.
+func (l *limiter) reserve(key string, size int, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &buckets{
+			messages: bucket{tokens: float64(l.limit.Burst)},
+			bytes:    bucket{tokens: float64(l.limit.BurstBytes)},
+			last:     now,
+		}
+		l.buckets[key] = b
+	}
+	elapsed := now.Sub(b.last).Seconds()
+	b.last = now
+	b.messages.refill(elapsed, l.limit.Messages, l.limit.Burst)
+	b.bytes.refill(elapsed, l.limit.Bytes, l.limit.BurstBytes)
+
+	var (
+		msgWait  = b.messages.wait(1, l.limit.Messages)
+		byteWait = b.bytes.wait(float64(size), l.limit.Bytes)
+		wait     = msgWait
+	)
+	if byteWait > wait {
+		wait = byteWait
+	}
+	if wait > 0 && l.limit.Action != LimitDelay {
+		return wait, false
+	}
+	if l.limit.Messages > 0 {
+		b.messages.tokens--
+	}
+	if l.limit.Bytes > 0 {
+		b.bytes.tokens -= float64(size)
+	}
+	return wait, true
+}
+
+// sweep removes the buckets of the keys not used since a while and fully refilled.
+func (l *limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < sweepPeriod {
+		return
+	}
+	l.swept = now
+	for key, b := range l.buckets {
+		elapsed := now.Sub(b.last).Seconds()
+		if elapsed < sweepPeriod.Seconds() {
+			continue
+		}
+		b.last = now
+		b.messages.refill(elapsed, l.limit.Messages, l.limit.Burst)
+		b.bytes.refill(elapsed, l.limit.Bytes, l.limit.BurstBytes)
+		if b.full(l.limit) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func (b *buckets) full(limit RateLimit) bool {
+	return (limit.Messages <= 0 || b.messages.tokens >= float64(limit.Burst)) &&
+		(limit.Bytes <= 0 || b.bytes.tokens >= float64(limit.BurstBytes))
+}
+
+func (b *bucket) refill(elapsed, rate float64, burst int) {
+	if rate <= 0 {
+		return
+	}
+	b.tokens = math.Min(float64(burst), b.tokens+elapsed*rate)
+}
+
+// wait returns the duration to wait to have n tokens.
+func (b *bucket) wait(n, rate float64) time.Duration {
+	if rate <= 0 || b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / rate * float64(time.Second))
+}
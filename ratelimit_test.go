@@ -0,0 +1,95 @@
+package tcp_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/rvflash/tcp"
+)
+
+func TestRateLimiter(t *testing.T) {
+	const slowDown = "slow down"
+	var (
+		dt = []struct {
+			limit   tcp.RateLimit
+			newIP   bool
+			msgs    []string
+			out     string
+			limited int
+		}{
+			{msgs: []string{"a", "b", "c"}, out: "abc"},
+			{
+				limit: tcp.RateLimit{Messages: 2, Action: tcp.LimitDrop},
+				msgs:  []string{"a", "b", "c"}, out: "ab", limited: 1,
+			},
+			{
+				limit: tcp.RateLimit{Messages: 1, Burst: 2, Action: tcp.LimitReply, Reply: []byte(slowDown)},
+				msgs:  []string{"a", "b", "c", "d"}, out: "ab" + slowDown + eol + slowDown + eol, limited: 2,
+			},
+			{
+				limit: tcp.RateLimit{Bytes: 4, Action: tcp.LimitDrop},
+				msgs:  []string{"ab", "cd", "e", "fghij"}, out: "abcd", limited: 2,
+			},
+			{
+				limit: tcp.RateLimit{Messages: 100, Burst: 1, Bytes: 1000, Action: tcp.LimitDelay},
+				msgs:  []string{"a", "b", "c"}, out: "abc", limited: 2,
+			},
+			{
+				limit: tcp.RateLimit{Messages: 1, Action: tcp.LimitClose},
+				msgs:  []string{"a", "b"}, out: "a", limited: 1,
+			},
+			{
+				// Each address has its own limits.
+				limit: tcp.RateLimit{Messages: 1, Key: tcp.KeyByIP, Action: tcp.LimitDrop},
+				newIP: true, msgs: []string{"a", "b"}, out: "ab",
+			},
+		}
+		are = is.New(t)
+	)
+	for i, tt := range dt {
+		tt := tt
+		t.Run("#"+strconv.Itoa(i), func(t *testing.T) {
+			var (
+				srv     = tcp.New()
+				rec     = tcp.NewRecorder()
+				limited int
+			)
+			srv.Use(func(c *tcp.Context) {
+				c.Next()
+				if len(c.Err()) > 0 {
+					are.Equal(c.Err()[0], tcp.ErrRateLimited) // mismatch error
+					limited++
+				}
+			})
+			if tt.limit.Messages > 0 || tt.limit.Bytes > 0 {
+				srv.Use(tcp.RateLimiter(tt.limit))
+			}
+			srv.ACK(func(c *tcp.Context) {
+				b, err := c.ReadAll()
+				are.NoErr(err)
+				_, err = c.ResponseWriter.Write(b)
+				are.NoErr(err)
+			})
+			// The SYN and FIN segments are not limited.
+			srv.ServeTCP(rec, tcp.NewRequest(tcp.SYN, nil))
+			start := time.Now()
+			for j, msg := range tt.msgs {
+				req := tcp.NewRequest(tcp.ACK, strings.NewReader(msg))
+				req.RemoteAddr = "127.0.0.1:9000"
+				if tt.newIP {
+					req.RemoteAddr = "127.0.0." + strconv.Itoa(j) + ":9000"
+				}
+				srv.ServeTCP(rec, req)
+			}
+			srv.ServeTCP(rec, tcp.NewRequest(tcp.FIN, nil))
+			are.Equal(rec.Body.String(), tt.out) // mismatch response
+			are.Equal(limited, tt.limited)       // mismatch limited messages
+			if tt.limit.Action == tcp.LimitDelay && tt.limited > 0 {
+				are.True(time.Since(start) >= 10*time.Millisecond) // expected delay
+			}
+		})
+	}
+}
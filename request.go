@@ -2,8 +2,10 @@ package tcp
 
 import (
 	"context"
+	"crypto/tls"
 	"io"
 	"io/ioutil"
+	"net"
 )
 
 // Request represents an TCP request.
@@ -14,8 +16,19 @@ type Request struct {
 	Body io.ReadCloser
 	// LogRemoteAddr returns the remote network address.
 	RemoteAddr string
+	// Listener is the listener which accepted the connection, if any.
+	Listener net.Listener
+	// TLS contains the state of the TLS connection, including the verified certificate chains of the client.
+	// It's nil if the connection does not use TLS.
+	TLS *tls.ConnectionState
 	// Context of the request.
 	ctx context.Context
+	// Connection of the request.
+	conn *conn
+	// Identifier of the request on its connection.
+	id uint64
+	// Reason of the closing of the connection.
+	err error
 }
 
 // Canceled listens the context of the request until its closing.
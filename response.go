@@ -10,9 +10,15 @@ type ResponseWriter interface {
 	// Size returns the number of bytes already written into the response body.
 	// -1: not already written
 	Size() int
+	// Flush sends any buffered data on the connection.
+	Flush() error
 	io.WriteCloser
 }
 
+type flusher interface {
+	Flush() error
+}
+
 func newWriter(wc io.WriteCloser) *responseWriter {
 	return &responseWriter{
 		ResponseWriter: wc,
@@ -35,6 +41,14 @@ func (r *responseWriter) Close() error {
 	return r.ResponseWriter.Close()
 }
 
+// Flush implements the ResponseWriter interface.
+func (r *responseWriter) Flush() error {
+	if f, ok := r.ResponseWriter.(flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
 // Size implements the ResponseWriter interface.
 func (r *responseWriter) Size() int {
 	return r.size
@@ -72,6 +86,41 @@ func (r *responseWriter) rebase(w io.WriteCloser) {
 	r.size = noWritten
 }
 
+// bufferedWriter retains the response until its flushing.
+// Each flush is written at once on the connection.
+type bufferedWriter struct {
+	buf bytes.Buffer
+	// w receives the buffered data on flush. If nil, the flush is ignored.
+	w io.Writer
+	c io.Closer
+	// size is the size of the buffer triggering a flush. If zero, no flush is triggered.
+	size int
+}
+
+// Close implements the io.WriteCloser interface.
+func (w *bufferedWriter) Close() error {
+	return w.c.Close()
+}
+
+// Flush writes the buffered data.
+func (w *bufferedWriter) Flush() error {
+	if w.w == nil || w.buf.Len() == 0 {
+		return nil
+	}
+	_, err := w.w.Write(w.buf.Bytes())
+	w.buf.Reset()
+	return err
+}
+
+// Write implements the io.WriteCloser interface.
+func (w *bufferedWriter) Write(p []byte) (int, error) {
+	n, err := w.buf.Write(p)
+	if err != nil || w.size <= 0 || w.buf.Len() < w.size {
+		return n, err
+	}
+	return n, w.Flush()
+}
+
 // ResponseRecorder is an implementation of http.ResponseWriter that records its changes.
 type ResponseRecorder struct {
 	// Body is the buffer to which the Handler's Write calls are sent.
@@ -90,6 +139,11 @@ func (r *ResponseRecorder) Close() error {
 	return nil
 }
 
+// Flush implements the ResponseWriter interface.
+func (r *ResponseRecorder) Flush() error {
+	return nil
+}
+
 // Size implements the ResponseWriter interface.
 func (r *ResponseRecorder) Size() int {
 	if r == nil || r.Body == nil {
@@ -69,3 +69,28 @@ func TestResponseWriter_WriteString(t *testing.T) {
 	// closes it.
 	are.NoErr(w.Close())
 }
+
+func TestBufferedWriter_Write(t *testing.T) {
+	var (
+		are = is.New(t)
+		rec = NewRecorder()
+		w   = &bufferedWriter{w: rec, c: rec, size: 4}
+	)
+	_, err := w.Write([]byte("hi"))
+	are.NoErr(err)
+	are.Equal(rec.Size(), 0) // expected buffered data
+	_, err = w.Write([]byte(" world"))
+	are.NoErr(err)
+	are.Equal(rec.Body.String(), "hi world") // expected flushed data
+	_, err = w.Write([]byte("!"))
+	are.NoErr(err)
+	are.NoErr(w.Flush())
+	are.Equal(rec.Body.String(), "hi world!") // mismatch data
+	are.NoErr(w.Close())
+	// Without writer, nothing is flushed.
+	w = &bufferedWriter{c: rec}
+	_, err = w.Write([]byte("hi"))
+	are.NoErr(err)
+	are.NoErr(w.Flush())
+	are.Equal(w.buf.String(), "hi") // expected retained data
+}
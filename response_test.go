@@ -1,7 +1,13 @@
 package tcp_test
 
 import (
+	"bufio"
+	"bytes"
+	"net"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/matryer/is"
 	"github.com/rvflash/tcp"
@@ -44,3 +50,52 @@ func TestResponseRecorder_Size(t *testing.T) {
 	are.Equal(w.Size(), 0)
 
 }
+
+func TestResponseRecorder_Flush(t *testing.T) {
+	is.New(t).NoErr(tcp.NewRecorder().Flush())
+}
+
+func TestServer_WriteBufferSize(t *testing.T) {
+	const (
+		addr  = ":9134"
+		parts = 5
+		calls = 20
+	)
+	var (
+		are = is.New(t)
+		srv = tcp.New()
+	)
+	srv.WriteBufferSize = 1024
+	srv.ACK(func(c *tcp.Context) {
+		b, err := c.ReadAll()
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		// Writes the response in several parts.
+		for i := 0; i < parts; i++ {
+			_, _ = c.ResponseWriter.Write(bytes.TrimSpace(b))
+			time.Sleep(time.Millisecond)
+		}
+		_, _ = c.ResponseWriter.Write([]byte(eol))
+	})
+	go func() {
+		are.NoErr(srv.Run(addr))
+	}()
+	time.Sleep(time.Millisecond * 100)
+
+	cli, err := net.Dial("tcp", addr)
+	are.NoErr(err)
+	defer func() {
+		are.NoErr(cli.Close())
+	}()
+	for i := 0; i < calls; i++ {
+		are.NoErr(writeConn(cli, strconv.Itoa(i%10)+eol))
+	}
+	r := bufio.NewReader(cli)
+	for i := 0; i < calls; i++ {
+		s, err := r.ReadString('\n')
+		are.NoErr(err)
+		are.Equal(s, strings.Repeat(s[:1], parts)+eol) // interleaved response
+	}
+}
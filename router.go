@@ -0,0 +1,150 @@
+package tcp
+
+// group is a Router with its own middlewares.
+// They are applied on the handlers registered by the group and its sub-groups.
+type group struct {
+	srv      *Server
+	parent   *group
+	handlers []HandlerFunc
+}
+
+// route contains handlers registered by a group.
+type route struct {
+	group    *group
+	handlers []HandlerFunc
+}
+
+// Any implements the Router interface.
+func (g *group) Any(segment string, f ...HandlerFunc) Router {
+	switch segment {
+	case ACK:
+		return g.ACK(f...)
+	case FIN:
+		return g.FIN(f...)
+	case SYN:
+		return g.SYN(f...)
+	default:
+		return g.Use(f...)
+	}
+}
+
+// ACK implements the Router interface.
+func (g *group) ACK(f ...HandlerFunc) Router {
+	g.srv.routes[ACK] = append(g.srv.routes[ACK], route{group: g, handlers: f})
+	g.srv.rebuild()
+	return g
+}
+
+// Command implements the Router interface.
+func (g *group) Command(name string, f ...HandlerFunc) Router {
+	name = commandName(name)
+	g.srv.commandRoutes[name] = append(g.srv.commandRoutes[name], route{group: g, handlers: f})
+	g.srv.rebuild()
+	return g
+}
+
+// FIN implements the Router interface.
+func (g *group) FIN(f ...HandlerFunc) Router {
+	g.srv.routes[FIN] = append(g.srv.routes[FIN], route{group: g, handlers: f})
+	g.srv.rebuild()
+	return g
+}
+
+// Group implements the Router interface.
+func (g *group) Group(f ...HandlerFunc) Router {
+	return &group{srv: g.srv, parent: g, handlers: f}
+}
+
+// NotFound implements the Router interface.
+func (g *group) NotFound(f ...HandlerFunc) Router {
+	g.srv.notFoundRoutes = append(g.srv.notFoundRoutes, route{group: g, handlers: f})
+	g.srv.rebuild()
+	return g
+}
+
+// SYN implements the Router interface.
+func (g *group) SYN(f ...HandlerFunc) Router {
+	g.srv.routes[SYN] = append(g.srv.routes[SYN], route{group: g, handlers: f})
+	g.srv.rebuild()
+	return g
+}
+
+// Use implements the Router interface.
+func (g *group) Use(f ...HandlerFunc) Router {
+	g.handlers = append(g.handlers, f...)
+	g.srv.rebuild()
+	return g
+}
+
+// path returns the groups from the root until this one.
+func (g *group) path() []*group {
+	if g.parent == nil {
+		return []*group{g}
+	}
+	return append(g.parent.path(), g)
+}
+
+// rebuild computes the chain of handlers of each route.
+func (s *Server) rebuild() {
+	handlers := make(map[string][]HandlerFunc, len(s.routes)+1)
+	handlers[ANY] = s.chain(nil)
+	for segment, r := range s.routes {
+		handlers[segment] = s.chain(r)
+	}
+	commands := make(map[string][]HandlerFunc, len(s.commandRoutes))
+	for name, r := range s.commandRoutes {
+		commands[name] = s.chain(r)
+	}
+	var notFound []HandlerFunc
+	if len(s.notFoundRoutes) > 0 {
+		notFound = s.chain(s.notFoundRoutes)
+	}
+	s.handlers, s.commands, s.notFound = handlers, commands, notFound
+}
+
+// chain returns the middlewares of the server followed by the handlers of each route.
+// The handlers of a group are scoped with its middlewares, so these only apply on them:
+// once aborted by one of them, the next routes registered out of the group are still handled.
+// The consecutive routes of a same group share the same scope.
+func (s *Server) chain(routes []route) []HandlerFunc {
+	var (
+		h     = append([]HandlerFunc{}, s.root.handlers...)
+		scope []HandlerFunc
+		last  *group
+	)
+	flush := func() {
+		if len(scope) > 0 {
+			h = append(h, scoped(scope))
+			scope = nil
+		}
+	}
+	for _, r := range routes {
+		if r.group == s.root {
+			flush()
+			h = append(h, r.handlers...)
+			last = nil
+			continue
+		}
+		if r.group != last {
+			flush()
+			for _, g := range r.group.path()[1:] {
+				scope = append(scope, g.handlers...)
+			}
+			last = r.group
+		}
+		scope = append(scope, r.handlers...)
+	}
+	flush()
+	return h
+}
+
+// scoped returns a handler running the given handlers as a sub-chain of the context.
+// Aborting the sub-chain does not abort the handlers following it.
+func scoped(handlers []HandlerFunc) HandlerFunc {
+	return func(c *Context) {
+		parent, index := c.handlers, c.index
+		c.handlers, c.index = handlers, -1
+		c.Next()
+		c.handlers, c.index = parent, index
+	}
+}
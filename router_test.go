@@ -0,0 +1,103 @@
+package tcp_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/rvflash/tcp"
+)
+
+func TestServer_Group(t *testing.T) {
+	var (
+		dt = []struct {
+			req *tcp.Request
+			out string
+		}{
+			{req: tcp.NewRequest(tcp.SYN, nil), out: "any>syn>"},
+			{req: tcp.NewRequest(tcp.FIN, nil), out: "any>"},
+			{req: tcp.NewRequest(tcp.ACK, strings.NewReader("PING")), out: "any>ping>"},
+			{req: tcp.NewRequest(tcp.ACK, strings.NewReader("GET key")), out: "any>auth>get>"},
+			{req: tcp.NewRequest(tcp.ACK, strings.NewReader("DEL key")), out: "any>auth>admin>del>"},
+			{req: tcp.NewRequest(tcp.ACK, strings.NewReader("SET key")), out: "any>auth>unknown>"},
+			{req: tcp.NewRequest("NOP", nil), out: "any>"},
+		}
+		are = is.New(t)
+		srv = tcp.New()
+	)
+	srv.SYN(mark("syn"))
+	srv.Command("PING", mark("ping"))
+	auth := srv.Group(mark("auth"))
+	auth.Command("GET", mark("get"))
+	auth.Group(mark("admin")).Command("DEL", mark("del"))
+	auth.NotFound(mark("unknown"))
+	// Middlewares registered after the routes also apply.
+	srv.Use(mark("any"))
+	for i, tt := range dt {
+		tt := tt
+		t.Run("#"+strconv.Itoa(i), func(t *testing.T) {
+			rec := tcp.NewRecorder()
+			srv.ServeTCP(rec, tt.req)
+			are.Equal(rec.Body.String(), tt.out) // mismatch chain
+		})
+	}
+}
+
+func TestServer_Group2(t *testing.T) {
+	var (
+		are = is.New(t)
+		srv = tcp.New()
+		rec = tcp.NewRecorder()
+	)
+	// The middleware of a group is only added once, before its first handlers.
+	srv.Use(mark("any"))
+	srv.ACK(mark("ack1"))
+	g := srv.Group(mark("grp"))
+	g.ACK(mark("ack2"))
+	g.Any(tcp.ACK, mark("ack3"))
+	srv.ACK(mark("ack4"))
+	srv.ServeTCP(rec, tcp.NewRequest(tcp.ACK, nil))
+	are.Equal(rec.Body.String(), "any>ack1>grp>ack2>ack3>ack4>")
+}
+
+func TestServer_Group3(t *testing.T) {
+	var (
+		dt = []struct {
+			req *tcp.Request
+			out string
+		}{
+			{req: tcp.NewRequest(tcp.SYN, nil), out: "any>auth>public>"},
+			{req: tcp.NewRequest(tcp.ACK, strings.NewReader("GET key")), out: "any>auth>root>"},
+		}
+		are = is.New(t)
+		srv = tcp.New()
+	)
+	// The middleware of a group only applies on its own handlers,
+	// so aborting them does not prevent the handlers of the root from running.
+	srv.Use(mark("any"))
+	g := srv.Group(func(c *tcp.Context) {
+		mark("auth")(c)
+		c.Abort()
+	})
+	g.SYN(mark("private"))
+	srv.SYN(mark("public"))
+	g.Command("SET", mark("set"))
+	g.NotFound(mark("unknown"))
+	srv.NotFound(mark("root"))
+	for i, tt := range dt {
+		tt := tt
+		t.Run("#"+strconv.Itoa(i), func(t *testing.T) {
+			rec := tcp.NewRecorder()
+			srv.ServeTCP(rec, tt.req)
+			are.Equal(rec.Body.String(), tt.out) // mismatch chain
+		})
+	}
+}
+
+// mark writes the given name in the response.
+func mark(name string) tcp.HandlerFunc {
+	return func(c *tcp.Context) {
+		_, _ = c.ResponseWriter.Write([]byte(name + ">"))
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"context"
 	"crypto/tls"
 	"net"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -31,6 +33,12 @@ type Router interface {
 	FIN(handler ...HandlerFunc) Router
 	// SYN is a shortcut for Any("SYN", ...HandlerFunc).
 	SYN(handler ...HandlerFunc) Router
+	// Command registers the handlers of the ACK messages starting by this command.
+	Command(name string, handler ...HandlerFunc) Router
+	// NotFound registers the handlers of the ACK messages without any matching command.
+	NotFound(handler ...HandlerFunc) Router
+	// Group returns a sub-router with its own middlewares, applied after the ones of its parent.
+	Group(handler ...HandlerFunc) Router
 }
 
 // List of supported segments.
@@ -61,10 +69,20 @@ func Default() *Server {
 // New returns a new instance of a TCP server.
 func New() *Server {
 	s := &Server{
-		handlers: map[string][]HandlerFunc{},
-		closing:  make(chan struct{}),
-		closed:   make(chan struct{}),
+		conns:         map[uint64]*conn{},
+		topics:        map[string]map[*conn]struct{}{},
+		numConnsPerIP: map[string]int{},
+		released:      make(chan struct{}),
+		routes:        map[string][]route{},
+		commandRoutes: map[string][]route{},
+		listeners:     map[net.Listener]net.Listener{},
+		active:        map[*conn]struct{}{},
+		closing:       make(chan struct{}),
+		closed:        make(chan struct{}),
 	}
+	s.ctx, s.cancelCtx = context.WithCancel(context.Background())
+	s.root = &group{srv: s}
+	s.rebuild()
 	s.pool.New = func() interface{} {
 		return s.allocateContext()
 	}
@@ -77,144 +95,447 @@ func (s *Server) allocateContext() *Context {
 
 // Server is the TCP server. It contains
 type Server struct {
-	// ReadTimeout is the maximum duration for reading the entire request, including the body.
+	// ReadTimeout is the maximum duration for reading the entire message, once its first byte is received.
 	// A zero value for t means Read will not time out.
 	ReadTimeout time.Duration
+	// IdleTimeout is the maximum amount of time to wait for the next message.
+	// It's reset on each message received. A zero value means no timeout.
+	IdleTimeout time.Duration
+	// WriteTimeout is the maximum duration for writing a response.
+	// A zero value means no timeout.
+	WriteTimeout time.Duration
+	// MaxLifetime is the maximum duration of a connection.
+	// A zero value means no limit.
+	MaxLifetime time.Duration
+	// WriteBufferSize enables the buffering of the responses when positive.
+	// The response of each request is then written at once on Flush, at the end of the request,
+	// or each time its buffer reaches this size.
+	// Otherwise, each write on the connection is done at once.
+	WriteBufferSize int
+	// OutboundQueueSize is the number of published messages queued on each connection.
+	// If zero, 64 messages can be queued.
+	OutboundQueueSize int
+	// SlowConsumer defines what to do when the outbound queue of a connection is full.
+	// By default, the message is dropped for this connection.
+	SlowConsumer SlowConsumerPolicy
+	// MaxConns is the maximum number of simultaneous connections.
+	// A zero value means no limit.
+	MaxConns int
+	// MaxConnsPerIP is the maximum number of simultaneous connections from a same IP address.
+	// A zero value means no limit.
+	MaxConnsPerIP int
+	// Overflow defines what to do with a new connection when a limit of connections is reached.
+	// By default, the connection is rejected. The rejection is served as a FIN segment, without SYN,
+	// reporting ErrTooManyConns or ErrTooManyConnsPerIP in Context.Err.
+	Overflow OverflowPolicy
+	// RejectMessage is written on each rejected connection, framed by the Framer, if not empty.
+	RejectMessage []byte
+	// MaxMessageSize is the maximum size of a message. A zero value means no limit.
+	// The built-in framers also have their own limit, the lowest one applies.
+	MaxMessageSize int
+	// Oversize defines what to do when a message exceeds the maximum size.
+	// By default, the message is skipped.
+	Oversize OversizePolicy
+	// MessageTooLargeReply is written, framed by the Framer, when a message exceeds the maximum size, if not nil.
+	MessageTooLargeReply []byte
+	// Framer splits the stream of each connection into messages.
+	// If nil, each message is delimited by a new line, as with NewLineFramer.
+	// Otherwise, it's also used to frame each message written by the Context.
+	Framer Framer
+	// Dispatch defines how the messages received on a same connection are handled.
+	// By default, each message is handled concurrently, see Concurrent.
+	Dispatch DispatchMode
+	// MaxPipelined is the maximum number of messages handled concurrently on a same connection
+	// with the Pipelined dispatch mode. If zero, the value of runtime.GOMAXPROCS is used.
+	MaxPipelined int
+	// Workers is the maximum number of goroutines handling the messages of all the connections
+	// with the Concurrent dispatch mode. A zero value means one goroutine per message.
+	Workers int
+	// QueueSize is the maximum number of messages waiting for a worker.
+	// Once reached, each connection with a new message stops reading until room is made,
+	// applying the TCP backpressure on the client. If zero, the value of Workers is used.
+	QueueSize int
+	// ConnState is called synchronously on each change of state of a connection, if not nil.
+	// It allows to build a custom tracking or admission logic, see ConnState.
+	ConnState func(net.Conn, ConnState)
+	// Drain enables the closing of each connection by the server on Shutdown, without waiting for its client.
+	// Each connection stops reading new messages, then it's closed once its messages in progress are handled.
+	// Its FIN segment reports ErrServerClosed in Context.Err.
+	Drain bool
+	// DrainMessage is written, framed by the Framer, on each drained connection before its closing, if not nil.
+	DrainMessage []byte
+	// TLSConfig optionally provides the TLS configuration used by RunTLS,
+	// to set the minimum version, the cipher suites, the ALPN protocols or the authentication of the clients.
+	// It's cloned before use.
+	TLSConfig *tls.Config
+	// SocketMode is the permissions of the socket file created by RunUnix.
+	// If zero, the permissions are only defined by the umask.
+	SocketMode os.FileMode
+	// CommandParser extracts the command of each message when at least one command is registered.
+	// If nil, ParseCommand is used.
+	CommandParser CommandParser
 
-	listener net.Listener
+	pool   sync.Pool
+	lastID uint64
+
+	// listeners and their connections
+	lnmu      sync.Mutex
+	listeners map[net.Listener]net.Listener
+	active    map[*conn]struct{}
+	w8        sync.WaitGroup
+
+	// live connections
+	mu    sync.RWMutex
+	conns map[uint64]*conn
+	// subscriptions by topic
+	tmu    sync.RWMutex
+	topics map[string]map[*conn]struct{}
+	// limits of connections
+	lmu           sync.Mutex
+	numConns      int
+	numConnsPerIP map[string]int
+	released      chan struct{}
+	// pool of workers
+	work workers
+
+	// routing
+	root           *group
+	routes         map[string][]route
+	commandRoutes  map[string][]route
+	notFoundRoutes []route
+	// chains of handlers, computed on each registration.
 	handlers map[string][]HandlerFunc
-	pool     sync.Pool
+	commands map[string][]HandlerFunc
+	notFound []HandlerFunc
 
 	// graceful shutdown
-	cancelCtx context.CancelFunc
+	onShutdown []func()
+	ctx        context.Context
+	cancelCtx  context.CancelFunc
 	closed,
 	closing chan struct{}
 }
 
 // Any attaches handlers on the given segment.
 func (s *Server) Any(segment string, f ...HandlerFunc) Router {
-	switch segment {
-	case ACK:
-		return s.ACK(f...)
-	case FIN:
-		return s.FIN(f...)
-	case SYN:
-		return s.SYN(f...)
-	default:
-		return s.Use(f...)
-	}
+	s.root.Any(segment, f...)
+	return s
 }
 
 // ACK allows to handle each new message.
 func (s *Server) ACK(f ...HandlerFunc) Router {
-	s.handlers[ACK] = append(s.handlers[ACK], f...)
+	s.root.ACK(f...)
+	return s
+}
+
+// Command allows to handle each new message starting by this command.
+// The command is case-insensitive.
+// Once a command is registered, a message without any matching command
+// is handled by the NotFound handlers or, if none, by the ACK ones.
+func (s *Server) Command(name string, f ...HandlerFunc) Router {
+	s.root.Command(name, f...)
 	return s
 }
 
 // FIN allows to handle when the connection is closed.
 func (s *Server) FIN(f ...HandlerFunc) Router {
-	s.handlers[FIN] = append(s.handlers[FIN], f...)
+	s.root.FIN(f...)
+	return s
+}
+
+// Group creates a sub-router with its own middlewares.
+// They only apply on the handlers registered by this group or its sub-groups.
+func (s *Server) Group(f ...HandlerFunc) Router {
+	return s.root.Group(f...)
+}
+
+// NotFound allows to handle each new message without any matching command.
+func (s *Server) NotFound(f ...HandlerFunc) Router {
+	s.root.NotFound(f...)
 	return s
 }
 
 // SYN allows to handle each new connection.
 func (s *Server) SYN(f ...HandlerFunc) Router {
-	s.handlers[SYN] = append(s.handlers[SYN], f...)
+	s.root.SYN(f...)
 	return s
 }
 
 // Use adds middleware(s) on all segments.
 func (s *Server) Use(f ...HandlerFunc) Router {
-	s.handlers[ANY] = append(s.handlers[ANY], f...)
+	s.root.Use(f...)
 	return s
 }
 
 const network = "tcp"
 
 // Run starts listening on TCP address.
+// It can be called several times to listen on many addresses.
 // This method will block the calling goroutine indefinitely unless an error happens.
-func (s *Server) Run(addr string) (err error) {
-	s.listener, err = net.Listen(network, addr)
+func (s *Server) Run(addr string) error {
+	l, err := net.Listen(network, addr)
 	if err != nil {
 		return err
 	}
-	return s.serve()
+	return s.Serve(l)
 }
 
 // RunTLS acts identically to the Run method, except that it uses the TLS protocol.
+// The certificate and the key files are optional if the TLSConfig of the server already
+// provides a certificate, otherwise they are loaded in addition to its configuration.
 // This method will block the calling goroutine indefinitely unless an error happens.
 func (s *Server) RunTLS(addr, certFile, keyFile string) error {
-	c, err := tlsConfig(certFile, keyFile)
+	c, err := s.tlsConfig(certFile, keyFile)
 	if err != nil {
 		return err
 	}
-	s.listener, err = tls.Listen(network, addr, c)
+	if !hasCertificate(c) {
+		return ErrTLSConfig
+	}
+	l, err := net.Listen(network, addr)
 	if err != nil {
 		return err
 	}
-	return s.serve()
+	// Keeps the TCP listener to be able to hand it off.
+	return s.serve(tls.NewListener(l, c), l)
 }
 
-func (s *Server) close() {
-	select {
-	case <-s.closed:
-		// Already closed.
-		return
-	default:
-		close(s.closed)
-	}
+// Serve accepts the connections on the given listener.
+// It allows to use any kind of listener, an in-memory one or one wrapped with its own logic.
+// Many listeners can be served concurrently by the same server, each connection knowing
+// the one it comes from with Request.Listener.
+// This method will block the calling goroutine indefinitely unless an error happens.
+func (s *Server) Serve(l net.Listener) error {
+	return s.serve(l, l)
 }
 
-func (s *Server) closeListener() error {
-	if s.cancelCtx == nil {
-		return nil
+// serve accepts the connections on the listener l, based on the raw listener.
+func (s *Server) serve(l, raw net.Listener) (err error) {
+	if !s.trackListener(l, raw) {
+		// Already shut down.
+		return l.Close()
 	}
-	s.cancelCtx()
-	return s.listener.Close()
-}
-
-func (s *Server) serve() (err error) {
-	var (
-		w8  sync.WaitGroup
-		ctx context.Context
-	)
-	ctx, s.cancelCtx = context.WithCancel(context.Background())
-	defer func() {
-		select {
-		case <-s.closed:
-		default:
-			err = s.closeListener()
-			return
-		}
-	}()
+	defer s.untrackListener(l)
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
 	for {
 		var c net.Conn
-		c, err = read(s.listener, s.ReadTimeout)
+		if err = s.waitConnSlot(ctx); err == nil {
+			c, err = l.Accept()
+		}
 		if err != nil {
 			select {
 			case <-s.closing:
 				// Stops listening but does not interrupt any active connections.
-				w8.Wait()
-				s.close()
+				s.w8.Wait()
 				return nil
 			default:
-				return
+				_ = l.Close()
+				return err
 			}
 		}
-		rwc := s.newConn(c)
-		w8.Add(1)
+		rwc := s.newConn(c, l)
+		if !s.addConn(rwc) {
+			// Accepted during the shutdown.
+			_ = c.Close()
+			continue
+		}
+		reason := s.acquireConn(ctx, rwc)
 		go func() {
-			defer w8.Done()
+			defer s.doneConn(rwc)
+			rwc.newState()
+			if reason != nil {
+				rwc.reject(ctx, reason)
+				return
+			}
+			defer s.releaseConn(rwc)
+			if err := s.acquireConnPerIP(ctx, rwc); err != nil {
+				rwc.reject(ctx, err)
+				return
+			}
+			if err := rwc.handshake(); err != nil {
+				rwc.abort(ctx, err)
+				return
+			}
 			rwc.serve(ctx)
 		}()
 	}
 }
 
-func (s *Server) newConn(c net.Conn) *conn {
+// trackListener adds the listener to the served ones, with the raw listener it is based on.
+// It fails once the server is shutting down.
+func (s *Server) trackListener(l, raw net.Listener) bool {
+	s.lnmu.Lock()
+	defer s.lnmu.Unlock()
+	select {
+	case <-s.closing:
+		return false
+	default:
+		s.listeners[l] = raw
+		return true
+	}
+}
+
+// untrackListener removes the listener of the served ones.
+func (s *Server) untrackListener(l net.Listener) {
+	s.lnmu.Lock()
+	delete(s.listeners, l)
+	s.lnmu.Unlock()
+}
+
+// addConn tracks a new active connection, except once the server is shutting down.
+func (s *Server) addConn(c *conn) bool {
+	s.lnmu.Lock()
+	defer s.lnmu.Unlock()
+	select {
+	case <-s.closing:
+		return false
+	default:
+		s.active[c] = struct{}{}
+		s.w8.Add(1)
+		return true
+	}
+}
+
+// doneConn stops tracking the connection, once its goroutine exits.
+// It's done once, by the goroutine or by the hijacking of the connection.
+func (s *Server) doneConn(c *conn) {
+	c.doneOnce.Do(func() {
+		s.lnmu.Lock()
+		delete(s.active, c)
+		s.lnmu.Unlock()
+		s.w8.Done()
+	})
+}
+
+// closeConns cancels the context of all the requests, then closes all the active connections,
+// reporting ErrServerClosed to their FIN segment.
+func (s *Server) closeConns() {
+	s.cancelCtx()
+	s.lnmu.Lock()
+	defer s.lnmu.Unlock()
+	for c := range s.active {
+		c.setErr(ErrServerClosed)
+		_ = c.Close()
+	}
+}
+
+// drainConns stops reading on all the active connections.
+// Each one is closed once its messages in progress are handled.
+func (s *Server) drainConns() {
+	s.lnmu.Lock()
+	defer s.lnmu.Unlock()
+	for c := range s.active {
+		c.drain()
+	}
+}
+
+// stopListening prevents any new listener or connection, then closes the listeners.
+// On the first call, the functions registered with RegisterOnShutdown are called in their own goroutine.
+func (s *Server) stopListening() error {
+	s.lnmu.Lock()
+	select {
+	case <-s.closing:
+	default:
+		close(s.closing)
+		for _, f := range s.onShutdown {
+			go f()
+		}
+	}
+	s.lnmu.Unlock()
+	return s.closeListeners()
+}
+
+// RegisterOnShutdown registers a function to call on Shutdown or Close.
+// It can be used to gracefully end the long-lived connections.
+func (s *Server) RegisterOnShutdown(f func()) {
+	s.lnmu.Lock()
+	s.onShutdown = append(s.onShutdown, f)
+	s.lnmu.Unlock()
+}
+
+// close reports the end of the server. It can be called concurrently, by Close and Shutdown.
+func (s *Server) close() {
+	s.lnmu.Lock()
+	defer s.lnmu.Unlock()
+	select {
+	case <-s.closed:
+		// Already closed.
+	default:
+		close(s.closed)
+	}
+}
+
+// closeListeners stops the listening on all the listeners, returning the first error.
+func (s *Server) closeListeners() (err error) {
+	s.lnmu.Lock()
+	defer s.lnmu.Unlock()
+	for l := range s.listeners {
+		if e := l.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Conn returns the live connection with this identifier, if exists.
+func (s *Server) Conn(id uint64) (Conn, bool) {
+	s.mu.RLock()
+	c, ok := s.conns[id]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return c, true
+}
+
+// Range calls f sequentially for each live connection.
+// If f returns false, range stops the iteration.
+func (s *Server) Range(f func(Conn) bool) {
+	s.mu.RLock()
+	conns := make([]*conn, 0, len(s.conns))
+	for _, c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.RUnlock()
+	for _, c := range conns {
+		if !f(c) {
+			return
+		}
+	}
+}
+
+func (s *Server) trackConn(c *conn, add bool) {
+	s.mu.Lock()
+	if add {
+		s.conns[c.id] = c
+	} else {
+		delete(s.conns, c.id)
+	}
+	s.mu.Unlock()
+}
+
+func (s *Server) framer() Framer {
+	if s.Framer == nil {
+		return NewLineFramer()
+	}
+	return s.Framer
+}
+
+func (s *Server) newConn(c net.Conn, l net.Listener) *conn {
+	var addr string
+	if a := c.RemoteAddr(); a != nil {
+		addr = a.String()
+	}
 	return &conn{
-		addr: c.RemoteAddr().String(),
-		srv:  s,
-		rwc:  c,
+		addr:  addr,
+		id:    atomic.AddUint64(&s.lastID, 1),
+		srv:   s,
+		rwc:   c,
+		ln:    l,
+		start: time.Now(),
+		done:  make(chan struct{}),
 	}
 }
 
@@ -224,12 +545,20 @@ func (s *Server) ServeTCP(w ResponseWriter, req *Request) {
 	ctx.writer.rebase(w)
 	ctx.Request = req
 	ctx.reset()
+	if req.err != nil {
+		// Reason of the closing of the connection.
+		ctx.Error(req.err)
+	}
 	s.handle(ctx)
 	s.pool.Put(ctx)
 }
 
 func (s *Server) handle(ctx *Context) {
-	ctx.handlers = s.computeHandlers(ctx.Request.Segment)
+	if ctx.Request.Segment == ACK && len(s.commands) > 0 {
+		ctx.handlers = s.routeCommand(ctx)
+	} else {
+		ctx.handlers = s.computeHandlers(ctx.Request.Segment)
+	}
 	if len(ctx.handlers) == 0 {
 		return
 	}
@@ -237,59 +566,60 @@ func (s *Server) handle(ctx *Context) {
 }
 
 func (s *Server) computeHandlers(segment string) []HandlerFunc {
-	m := make([]HandlerFunc, len(s.handlers[ANY])+len(s.handlers[segment]))
-	copy(m, s.handlers[ANY])
-	copy(m[len(s.handlers[ANY]):], s.handlers[segment])
-	return m
+	if h, ok := s.handlers[segment]; ok {
+		return h
+	}
+	// Only the middlewares.
+	return s.handlers[ANY]
 }
 
 // Shutdown gracefully shuts down the server without interrupting any
 // active connections. Shutdown works by first closing all open listeners and
 // then waiting indefinitely for connections to return to idle and then shut down.
+// With Drain, each connection stops reading and is closed once its messages in progress are handled.
+// Context.ShuttingDown notifies the handlers of the shutdown.
 // If the provided context expires before the closing is complete,
-// Shutdown returns the context's error.
+// Shutdown forces the closing of the active connections as Close does, then returns the context's error.
 func (s *Server) Shutdown(ctx context.Context) error {
 	if s.closing == nil {
 		// Nothing to do
 		return nil
 	}
-	close(s.closing)
-
-	// Stops listening.
-	err := s.closeListener()
+	err := s.stopListening()
 	if err != nil {
 		return err
 	}
-	for {
-		select {
-		case <-ctx.Done():
-			// Forces closing of all actives connections.
-			s.close()
-			return ctx.Err()
-		case <-s.closed:
-			return nil
-		}
+	if s.Drain {
+		s.drainConns()
+	}
+	go func() {
+		s.w8.Wait()
+		s.close()
+	}()
+	select {
+	case <-ctx.Done():
+		// Forces closing of all actives connections.
+		s.closeConns()
+		s.w8.Wait()
+		s.close()
+		return ctx.Err()
+	case <-s.closed:
+		return nil
 	}
 }
 
-func tlsConfig(certFile, keyFile string) (*tls.Config, error) {
-	var err error
-	c := make([]tls.Certificate, 1)
-	c[0], err = tls.LoadX509KeyPair(certFile, keyFile)
-	return &tls.Config{Certificates: c}, err
-}
-
-func read(l net.Listener, to time.Duration) (net.Conn, error) {
-	c, err := l.Accept()
-	if err != nil {
-		return nil, err
-	}
-	if to == 0 {
-		return c, nil
-	}
-	err = c.SetReadDeadline(time.Now().Add(to))
-	if err != nil {
-		return nil, err
+// Close immediately closes all the listeners and the active connections.
+// The context of each request is cancelled and the FIN segment of each connection
+// reports ErrServerClosed in Context.Err.
+// It returns once all the connections are closed, with the error of the closing of the listeners, if any.
+func (s *Server) Close() error {
+	if s.closing == nil {
+		// Nothing to do
+		return nil
 	}
-	return c, nil
+	err := s.stopListening()
+	s.closeConns()
+	s.w8.Wait()
+	s.close()
+	return err
 }
@@ -1,6 +1,8 @@
 package tcp_test
 
 import (
+	"bufio"
+	"context"
 	"crypto/tls"
 	"fmt"
 	"io"
@@ -191,3 +193,188 @@ func bye(_ *tcp.Context) {
 func welcome(c *tcp.Context) {
 	c.String(welcomeMsg)
 }
+
+func TestServer_Framer(t *testing.T) {
+	const addr = ":9124"
+	var (
+		are = is.New(t)
+		srv = tcp.New()
+		f   = tcp.NewLengthPrefixFramer(2, nil)
+	)
+	srv.Framer = f
+	srv.ACK(acknowledge)
+	go func() {
+		are.NoErr(srv.Run(addr))
+	}()
+	time.Sleep(time.Millisecond * 100)
+
+	cli, err := net.Dial("tcp", addr)
+	are.NoErr(err)
+	defer func() {
+		are.NoErr(cli.Close())
+	}()
+	b, err := f.Frame([]byte(hiMsg))
+	are.NoErr(err)
+	_, err = cli.Write(b)
+	are.NoErr(err)
+	out, err := f.ReadFrame(bufio.NewReader(cli))
+	are.NoErr(err)
+	are.Equal(string(out), fmt.Sprintf(receivedMsg, len(hiMsg)))
+}
+
+func TestServer_Serve2(t *testing.T) {
+	const addr = ":9144"
+	var (
+		are  = is.New(t)
+		pipe = newPipeListener()
+		srv  = tcp.New()
+		done = make(chan error, 2)
+	)
+	srv.SYN(func(c *tcp.Context) {
+		c.String(c.Request.Listener.Addr().Network())
+	})
+	go func() {
+		done <- srv.Run(addr)
+	}()
+	go func() {
+		done <- srv.Serve(pipe)
+	}()
+	time.Sleep(time.Millisecond * 100)
+
+	cli, err := net.Dial("tcp", addr)
+	are.NoErr(err)
+	out, err := bufio.NewReader(cli).ReadString('\n')
+	are.NoErr(err)
+	are.Equal(out, "tcp"+eol) // mismatch listener
+	are.NoErr(cli.Close())
+
+	cli, err = pipe.Dial()
+	are.NoErr(err)
+	out, err = bufio.NewReader(cli).ReadString('\n')
+	are.NoErr(err)
+	are.Equal(out, "pipe"+eol) // mismatch listener
+	are.NoErr(cli.Close())
+
+	// Stops listening on both listeners.
+	are.NoErr(srv.Shutdown(context.Background()))
+	are.NoErr(<-done)
+	are.NoErr(<-done)
+	_, err = net.Dial("tcp", addr)
+	are.True(err != nil) // expected closed listener
+}
+
+func TestServer_Close(t *testing.T) {
+	var (
+		dt = []struct {
+			addr     string
+			shutdown bool
+			err      error
+		}{
+			{addr: ":9149"},
+			{addr: ":9150", shutdown: true, err: context.DeadlineExceeded},
+		}
+		are = is.New(t)
+	)
+	for i, tt := range dt {
+		tt := tt
+		t.Run("#"+strconv.Itoa(i), func(t *testing.T) {
+			var (
+				srv      = tcp.New()
+				canceled = make(chan struct{}, 1)
+				fin      = make(chan error, 1)
+			)
+			srv.ACK(func(c *tcp.Context) {
+				<-c.Request.Canceled()
+				canceled <- struct{}{}
+			})
+			srv.FIN(func(c *tcp.Context) {
+				fin <- c.Err()
+			})
+			go func() {
+				are.NoErr(srv.Run(tt.addr))
+			}()
+			time.Sleep(time.Millisecond * 100)
+
+			cli, err := net.Dial("tcp", tt.addr)
+			are.NoErr(err)
+			defer func() {
+				_ = cli.Close()
+			}()
+			are.NoErr(writeConn(cli, hiMsg))
+			time.Sleep(time.Millisecond * 50)
+
+			if tt.shutdown {
+				ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+				defer cancel()
+				err = srv.Shutdown(ctx)
+			} else {
+				err = srv.Close()
+			}
+			are.Equal(err, tt.err) // mismatch error
+			// All the connections are closed once returned.
+			select {
+			case <-canceled:
+			default:
+				t.Fatal("expected cancelled request")
+			}
+			select {
+			case err = <-fin:
+				are.Equal(err, tcp.Errors{tcp.ErrServerClosed}) // mismatch reason
+			default:
+				t.Fatal("expected closed connection")
+			}
+			_, err = bufio.NewReader(cli).ReadString('\n')
+			are.Equal(err, io.EOF) // expected closed connection
+		})
+	}
+}
+
+func TestServer_Drain(t *testing.T) {
+	const addr = ":9151"
+	var (
+		are  = is.New(t)
+		srv  = tcp.New()
+		hook = make(chan struct{}, 1)
+		fin  = make(chan error, 1)
+	)
+	srv.Drain = true
+	srv.DrainMessage = []byte("bye")
+	srv.RegisterOnShutdown(func() {
+		hook <- struct{}{}
+	})
+	srv.ACK(func(c *tcp.Context) {
+		<-c.ShuttingDown()
+		c.String("done")
+	})
+	srv.FIN(func(c *tcp.Context) {
+		fin <- c.Err()
+	})
+	go func() {
+		are.NoErr(srv.Run(addr))
+	}()
+	time.Sleep(time.Millisecond * 100)
+
+	cli, err := net.Dial("tcp", addr)
+	are.NoErr(err)
+	defer func() {
+		_ = cli.Close()
+	}()
+	are.NoErr(writeConn(cli, hiMsg))
+	time.Sleep(time.Millisecond * 50)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	are.NoErr(srv.Shutdown(ctx))
+	<-hook
+	are.Equal(<-fin, tcp.Errors{tcp.ErrServerClosed}) // mismatch reason
+
+	// The message in progress is handled before the closing.
+	r := bufio.NewReader(cli)
+	for _, s := range []string{"done", "bye"} {
+		out, err := r.ReadString('\n')
+		are.NoErr(err)
+		are.Equal(out, s+eol) // mismatch response
+	}
+	_, err = r.ReadString('\n')
+	are.Equal(err, io.EOF) // expected closed connection
+}
@@ -0,0 +1,61 @@
+package tcp
+
+import "sync/atomic"
+
+// ConnState represents the state of a connection, reported to the Server.ConnState hook.
+type ConnState int32
+
+// List of states of a connection.
+const (
+	// StateNew is the state of a connection just accepted, before its SYN segment.
+	StateNew ConnState = iota
+	// StateActive is the state of a connection receiving a message.
+	StateActive
+	// StateIdle is the state of a connection waiting for a new message.
+	// With the Concurrent and Pipelined dispatch modes, the previous messages may still be in progress.
+	StateIdle
+	// StateClosing is the state of a connection no more reading, before its FIN segment.
+	StateClosing
+	// StateClosed is the state of a closed connection. It's a terminal state.
+	StateClosed
+	// StateHijacked is the state of a connection taken over by a handler. It's a terminal state.
+	StateHijacked
+)
+
+var stateName = map[ConnState]string{
+	StateNew:      "new",
+	StateActive:   "active",
+	StateIdle:     "idle",
+	StateClosing:  "closing",
+	StateClosed:   "closed",
+	StateHijacked: "hijacked",
+}
+
+// String implements the fmt.Stringer interface.
+func (s ConnState) String() string {
+	return stateName[s]
+}
+
+// newState reports the new connection.
+func (c *conn) newState() {
+	if f := c.srv.ConnState; f != nil {
+		f(c.netConn(), StateNew)
+	}
+}
+
+// setState changes the state of the connection, then reports it if it has changed.
+// Once closed or hijacked, the state can no more change.
+func (c *conn) setState(st ConnState) {
+	for {
+		prev := ConnState(atomic.LoadInt32(&c.state))
+		if prev == st || prev == StateClosed || prev == StateHijacked {
+			return
+		}
+		if atomic.CompareAndSwapInt32(&c.state, int32(prev), int32(st)) {
+			break
+		}
+	}
+	if f := c.srv.ConnState; f != nil {
+		f(c.netConn(), st)
+	}
+}
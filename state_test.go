@@ -0,0 +1,70 @@
+package tcp_test
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/rvflash/tcp"
+)
+
+func TestConnState_String(t *testing.T) {
+	are := is.New(t)
+	are.Equal(tcp.StateNew.String(), "new")           // mismatch name
+	are.Equal(tcp.StateHijacked.String(), "hijacked") // mismatch name
+	are.Equal(tcp.ConnState(-1).String(), "")         // unexpected name
+}
+
+func TestServer_ConnState(t *testing.T) {
+	const addr = ":9153"
+	var (
+		are    = is.New(t)
+		srv    = tcp.New()
+		mu     sync.Mutex
+		states []tcp.ConnState
+		closed = make(chan struct{})
+	)
+	srv.Dispatch = tcp.Sequential
+	srv.ConnState = func(c net.Conn, st tcp.ConnState) {
+		are.True(c != nil) // expected connection
+		mu.Lock()
+		states = append(states, st)
+		mu.Unlock()
+		if st == tcp.StateClosed {
+			close(closed)
+		}
+	}
+	srv.ACK(func(c *tcp.Context) {
+		c.String("ok")
+	})
+	go func() {
+		are.NoErr(srv.Run(addr))
+	}()
+	time.Sleep(time.Millisecond * 100)
+
+	cli, err := net.Dial("tcp", addr)
+	are.NoErr(err)
+	are.NoErr(writeConn(cli, hiMsg))
+	_, err = bufio.NewReader(cli).ReadString('\n')
+	are.NoErr(err)
+	are.NoErr(cli.Close())
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("expected closed connection")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	are.Equal(states, []tcp.ConnState{
+		tcp.StateNew,
+		tcp.StateIdle,
+		tcp.StateActive,
+		tcp.StateIdle,
+		tcp.StateClosing,
+		tcp.StateClosed,
+	}) // mismatch states
+}
@@ -0,0 +1,179 @@
+package tcp
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// List of TLS errors.
+var (
+	// ErrTLSHandshake is the reason of the closing of a connection failing to complete the TLS handshake.
+	ErrTLSHandshake = NewError("tls handshake failed")
+	// ErrTLSConfig is returned by StartTLS without any TLS configuration.
+	ErrTLSConfig = NewError("missing tls config")
+	// ErrTLSStarted is returned by StartTLS if the connection already uses TLS or another request started it.
+	ErrTLSStarted = NewError("tls already started")
+)
+
+// errPaused is returned when the reading is interrupted by an upgrade of the connection.
+var errPaused = errors.New("paused")
+
+// aLongTimeAgo is a deadline in the past, used to interrupt a reading.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// tlsConfig returns a copy of the TLS configuration of the server,
+// completed by the certificate in the given files, if any.
+func (s *Server) tlsConfig(certFile, keyFile string) (*tls.Config, error) {
+	c := &tls.Config{}
+	if s.TLSConfig != nil {
+		c = s.TLSConfig.Clone()
+	}
+	if certFile == "" && keyFile == "" {
+		return c, nil
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	c.Certificates = append(c.Certificates, cert)
+	return c, nil
+}
+
+// hasCertificate returns true if the TLS configuration can provide a certificate.
+func hasCertificate(c *tls.Config) bool {
+	return len(c.Certificates) > 0 || c.GetCertificate != nil || c.GetConfigForClient != nil
+}
+
+// StartTLS upgrades the connection to TLS once the response of the current request is sent.
+// The other requests in progress on the connection do not wait for it.
+// The next messages are read over TLS and Request.TLS exposes the new state of the connection.
+// If cfg is nil, the TLSConfig of the server is used.
+// It must be called before writing the response, the reading of the messages being paused from the call.
+// Any message received in plaintext after this one and not yet handled is dropped.
+// If the handshake fails, the connection is closed, reporting ErrTLSHandshake in the Context.Err of the FIN segment.
+func (c *Context) StartTLS(cfg *tls.Config) error {
+	if c.Request == nil || c.Request.conn == nil {
+		return ErrRequest
+	}
+	return c.Request.conn.requestTLS(c.Request.id, cfg)
+}
+
+// requestTLS records the TLS configuration to use to upgrade the connection at the end of the request id.
+// The reading of the messages is paused from now until the end of the upgrade,
+// so the client's handshake can not be read as a plaintext message.
+func (c *conn) requestTLS(id uint64, cfg *tls.Config) error {
+	if cfg == nil {
+		cfg = c.srv.TLSConfig
+	}
+	if cfg == nil {
+		return ErrTLSConfig
+	}
+	if c.tlsState() != nil {
+		return ErrTLSStarted
+	}
+	c.umu.Lock()
+	defer c.umu.Unlock()
+	if c.startTLS != nil && c.tlsReq != id {
+		// Already requested by another request in progress.
+		return ErrTLSStarted
+	}
+	if c.startTLS == nil {
+		c.resume = make(chan struct{})
+	}
+	c.startTLS, c.tlsReq = cfg, id
+	// Interrupts the reading of the next message.
+	atomic.StoreInt32(&c.pausing, 1)
+	_ = c.netConn().SetReadDeadline(aLongTimeAgo)
+	return nil
+}
+
+// tlsState returns the state of the TLS connection, nil if it does not use TLS.
+func (c *conn) tlsState() *tls.ConnectionState {
+	c.nmu.RLock()
+	defer c.nmu.RUnlock()
+	return c.tls
+}
+
+// handshake runs the TLS handshake of a TLS connection, limited by the ReadTimeout of the server.
+// Once done, the state of the TLS connection is exposed on each request.
+func (c *conn) handshake() error {
+	tc, ok := c.netConn().(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	return c.handshakeTLS(tc)
+}
+
+func (c *conn) handshakeTLS(tc *tls.Conn) error {
+	err := tc.SetDeadline(c.deadline(c.srv.ReadTimeout))
+	if err != nil {
+		return err
+	}
+	if err = tc.Handshake(); err != nil {
+		return ErrTLSHandshake
+	}
+	err = tc.SetDeadline(time.Time{})
+	if err != nil {
+		return err
+	}
+	st := tc.ConnectionState()
+	c.nmu.Lock()
+	c.rwc = tc
+	c.tls = &st
+	c.nmu.Unlock()
+	return nil
+}
+
+// upgrade switches the connection to TLS, if requested by the request id.
+// On failure, the connection is closed.
+func (c *conn) upgrade(id uint64) {
+	c.umu.Lock()
+	defer c.umu.Unlock()
+	cfg := c.startTLS
+	if cfg == nil || c.tlsReq != id {
+		return
+	}
+	c.startTLS = nil
+	defer func() {
+		// Resumes the reading of the messages.
+		atomic.StoreInt32(&c.pausing, 0)
+		close(c.resume)
+		c.resume = nil
+	}()
+	if c.hijacked() {
+		// Owned by the handler.
+		return
+	}
+	rwc := c.netConn()
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	// No other write during the handshake.
+	c.wmu.Lock()
+	err := c.handshakeTLS(tls.Server(rwc, cfg))
+	c.wmu.Unlock()
+	if err != nil {
+		c.setErr(err)
+		_ = rwc.Close()
+		return
+	}
+	// Drops the messages received in plaintext.
+	c.br = bufio.NewReader(c.netConn())
+}
+
+// paused returns true if the reading is paused by an upgrade of the connection.
+func (c *conn) paused() bool {
+	return atomic.LoadInt32(&c.pausing) == 1
+}
+
+// waitUpgrade blocks until the end of the upgrade of the connection.
+func (c *conn) waitUpgrade() {
+	c.umu.Lock()
+	resume := c.resume
+	c.umu.Unlock()
+	if resume != nil {
+		<-resume
+	}
+}
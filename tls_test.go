@@ -0,0 +1,168 @@
+package tcp_test
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/rvflash/tcp"
+)
+
+func TestServer_TLSConfig(t *testing.T) {
+	const addr = ":9145"
+	var (
+		are = is.New(t)
+		srv = tcp.New()
+		fin = make(chan error, 1)
+	)
+	srv.TLSConfig = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"tcp"},
+		ClientAuth: tls.RequireAnyClientCert,
+	}
+	srv.SYN(func(c *tcp.Context) {
+		st := c.Request.TLS
+		c.String(st.PeerCertificates[0].Subject.Organization[0] + " " + st.NegotiatedProtocol)
+	})
+	srv.FIN(func(c *tcp.Context) {
+		fin <- c.Err()
+	})
+	go func() {
+		are.NoErr(srv.RunTLS(addr, certFile, keyFile))
+	}()
+	time.Sleep(time.Millisecond * 100)
+
+	// Authenticated client
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	are.NoErr(err)
+	cli, err := tls.Dial("tcp", addr, &tls.Config{
+		Certificates:       []tls.Certificate{cert},
+		NextProtos:         []string{"tcp"},
+		InsecureSkipVerify: true,
+	})
+	are.NoErr(err)
+	out, err := bufio.NewReader(cli).ReadString('\n')
+	are.NoErr(err)
+	are.Equal(out, "RvFlash tcp"+eol) // mismatch client identity
+	are.NoErr(cli.Close())
+	are.Equal(<-fin, nil) // unexpected error
+
+	// Client without certificate
+	cli, err = tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err == nil {
+		_, err = bufio.NewReader(cli).ReadString('\n')
+		are.True(err != nil) // expected handshake failure
+		_ = cli.Close()
+	}
+	are.Equal(<-fin, tcp.Errors{tcp.ErrTLSHandshake}) // mismatch reason
+}
+
+func TestContext_StartTLS(t *testing.T) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	is.New(t).NoErr(err)
+	var (
+		dt = []struct {
+			addr string
+			mode tcp.DispatchMode
+		}{
+			{addr: ":9146", mode: tcp.Concurrent},
+			{addr: ":9147", mode: tcp.Sequential},
+			{addr: ":9148", mode: tcp.Pipelined},
+		}
+		are = is.New(t)
+	)
+	for i, tt := range dt {
+		tt := tt
+		t.Run("#"+strconv.Itoa(i), func(t *testing.T) {
+			srv := tcp.New()
+			srv.Dispatch = tt.mode
+			srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+			srv.Command("STARTTLS", func(c *tcp.Context) {
+				are.NoErr(c.StartTLS(nil))
+				c.String("ready")
+				// The client's handshake must not be read as a message.
+				time.Sleep(time.Millisecond * 50)
+			})
+			srv.Command("PING", func(c *tcp.Context) {
+				c.String("pong " + strconv.FormatBool(c.Request.TLS != nil))
+			})
+			go func() {
+				are.NoErr(srv.Run(tt.addr))
+			}()
+			time.Sleep(time.Millisecond * 100)
+
+			cli, err := net.Dial("tcp", tt.addr)
+			are.NoErr(err)
+			defer func() {
+				_ = cli.Close()
+			}()
+			r := bufio.NewReader(cli)
+			for _, s := range [][2]string{{"PING", "pong false"}, {"STARTTLS", "ready"}} {
+				are.NoErr(writeConn(cli, s[0]+eol))
+				out, err := r.ReadString('\n')
+				are.NoErr(err)
+				are.Equal(out, s[1]+eol) // mismatch plaintext response
+			}
+			tc := tls.Client(cli, &tls.Config{InsecureSkipVerify: true})
+			are.NoErr(tc.Handshake())
+			are.NoErr(writeConn(tc, "PING"+eol))
+			out, err := bufio.NewReader(tc).ReadString('\n')
+			are.NoErr(err)
+			are.Equal(out, "pong true"+eol) // mismatch TLS response
+		})
+	}
+}
+
+func TestContext_StartTLS2(t *testing.T) {
+	const addr = ":9156"
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	is.New(t).NoErr(err)
+	var (
+		are = is.New(t)
+		srv = tcp.New()
+	)
+	srv.Dispatch = tcp.Concurrent
+	srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	srv.Command("SLOW", func(c *tcp.Context) {
+		time.Sleep(time.Millisecond * 10)
+		c.String("slow")
+	})
+	srv.Command("STARTTLS", func(c *tcp.Context) {
+		are.NoErr(c.StartTLS(nil))
+		// Another request ends in the meantime.
+		time.Sleep(time.Millisecond * 50)
+		c.String("ready")
+	})
+	srv.Command("PING", func(c *tcp.Context) {
+		c.String("pong " + strconv.FormatBool(c.Request.TLS != nil))
+	})
+	go func() {
+		are.NoErr(srv.Run(addr))
+	}()
+	time.Sleep(time.Millisecond * 100)
+
+	cli, err := net.Dial("tcp", addr)
+	are.NoErr(err)
+	defer func() {
+		_ = cli.Close()
+	}()
+	are.NoErr(cli.SetDeadline(time.Now().Add(time.Second)))
+	are.NoErr(writeConn(cli, "SLOW"+eol+"STARTTLS"+eol))
+	r := bufio.NewReader(cli)
+	for _, s := range []string{"slow", "ready"} {
+		out, err := r.ReadString('\n')
+		are.NoErr(err)
+		are.Equal(out, s+eol) // mismatch plaintext response
+	}
+	// Only upgraded at the end of the request starting it.
+	tc := tls.Client(cli, &tls.Config{InsecureSkipVerify: true})
+	are.NoErr(tc.Handshake())
+	are.NoErr(writeConn(tc, "PING"+eol))
+	out, err := bufio.NewReader(tc).ReadString('\n')
+	are.NoErr(err)
+	are.Equal(out, "pong true"+eol) // mismatch TLS response
+}
@@ -0,0 +1,55 @@
+package tcp
+
+import (
+	"net"
+	"os"
+)
+
+const unixNetwork = "unix"
+
+// ErrSocketInUse is returned by RunUnix if the socket file is still used by another process.
+var ErrSocketInUse = NewError("socket in use")
+
+// RunUnix starts listening on the Unix domain socket at the given path.
+// A stale socket file, left by a previous process, is removed first.
+// Once listening, the socket file gets the SocketMode permissions, if set.
+// It's removed when the server stops listening.
+// This method will block the calling goroutine indefinitely unless an error happens.
+func (s *Server) RunUnix(path string) error {
+	err := removeStaleSocket(path)
+	if err != nil {
+		return err
+	}
+	l, err := net.Listen(unixNetwork, path)
+	if err != nil {
+		return err
+	}
+	if s.SocketMode != 0 {
+		if err = os.Chmod(path, s.SocketMode); err != nil {
+			_ = l.Close()
+			return err
+		}
+	}
+	return s.Serve(l)
+}
+
+// removeStaleSocket removes the socket file at the given path if no process is listening on it.
+// It fails if the file is not a socket or if the socket is in use.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return &os.PathError{Op: "listen", Path: path, Err: os.ErrExist}
+	}
+	c, err := net.Dial(unixNetwork, path)
+	if err == nil {
+		_ = c.Close()
+		return ErrSocketInUse
+	}
+	return os.Remove(path)
+}
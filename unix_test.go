@@ -0,0 +1,120 @@
+package tcp_test
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/rvflash/tcp"
+)
+
+func TestServer_RunUnix(t *testing.T) {
+	are := is.New(t)
+	dir, err := ioutil.TempDir("", "tcp")
+	are.NoErr(err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	path := filepath.Join(dir, "tcp.sock")
+
+	// Leaves a stale socket file.
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	are.NoErr(err)
+	l.SetUnlinkOnClose(false)
+	are.NoErr(l.Close())
+
+	srv := tcp.New()
+	srv.SocketMode = 0600
+	srv.SYN(welcome)
+	go func() {
+		are.NoErr(srv.RunUnix(path))
+	}()
+	time.Sleep(time.Millisecond * 100)
+
+	fi, err := os.Stat(path)
+	are.NoErr(err)
+	are.Equal(fi.Mode().Perm(), os.FileMode(0600))         // mismatch permissions
+	are.Equal(tcp.New().RunUnix(path), tcp.ErrSocketInUse) // expected socket in use
+
+	cli, err := net.Dial("unix", path)
+	are.NoErr(err)
+	out, err := bufio.NewReader(cli).ReadString('\n')
+	are.NoErr(err)
+	are.Equal(out, welcomeMsg) // mismatch response
+	are.NoErr(cli.Close())
+
+	are.NoErr(srv.Shutdown(context.Background()))
+	_, err = os.Stat(path)
+	are.True(os.IsNotExist(err)) // expected removed socket file
+}
+
+func TestServer_Serve(t *testing.T) {
+	var (
+		are = is.New(t)
+		l   = newPipeListener()
+		srv = tcp.New()
+	)
+	srv.SYN(welcome)
+	go func() {
+		are.NoErr(srv.Serve(l))
+	}()
+	cli, err := l.Dial()
+	are.NoErr(err)
+	out, err := bufio.NewReader(cli).ReadString('\n')
+	are.NoErr(err)
+	are.Equal(out, welcomeMsg) // mismatch response
+	are.NoErr(cli.Close())
+	are.NoErr(srv.Shutdown(context.Background()))
+}
+
+// pipeListener is an in-memory listener.
+type pipeListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+func (l *pipeListener) Dial() (net.Conn, error) {
+	srv, cli := net.Pipe()
+	select {
+	case l.conns <- srv:
+		return cli, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	close(l.done)
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
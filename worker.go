@@ -0,0 +1,121 @@
+package tcp
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WorkerStats contains statistics about the workers handling the messages.
+type WorkerStats struct {
+	// Workers is the maximum number of workers.
+	Workers int
+	// Running is the number of workers currently started.
+	Running int
+	// QueueSize is the maximum number of messages waiting for a worker.
+	QueueSize int
+	// Queued is the number of messages currently waiting for a worker.
+	Queued int
+	// Blocked is the number of connections currently waiting for room in the queue.
+	Blocked int
+	// WaitCount is the total number of messages waited for room in the queue.
+	WaitCount int64
+	// WaitDuration is the total time the connections were blocked waiting for room in the queue.
+	WaitDuration time.Duration
+	// QueueDuration is the total time between the reception of the messages and their handling by a worker.
+	QueueDuration time.Duration
+}
+
+// job is a message waiting for a worker.
+type job struct {
+	ctx    context.Context
+	c      *conn
+	f      frame
+	queued time.Time
+	done   func()
+}
+
+// workers is the pool of goroutines handling the messages of all the connections.
+// A worker is started on demand, up to the maximum, and stops once the queue is empty.
+type workers struct {
+	once  sync.Once
+	queue chan job
+	mu    sync.Mutex
+	stats WorkerStats
+}
+
+// WorkerStats returns statistics about the workers.
+// If Workers is not set, each message being handled in its own goroutine, only the zero value is returned.
+func (s *Server) WorkerStats() WorkerStats {
+	if s.Workers <= 0 {
+		return WorkerStats{}
+	}
+	w := s.workers()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	st := w.stats
+	st.Workers = s.Workers
+	st.QueueSize = cap(w.queue)
+	st.Queued = len(w.queue)
+	return st
+}
+
+func (s *Server) workers() *workers {
+	s.work.once.Do(func() {
+		n := s.QueueSize
+		if n <= 0 {
+			n = s.Workers
+		}
+		s.work.queue = make(chan job, n)
+	})
+	return &s.work
+}
+
+// submit queues the message for a worker.
+// It blocks while the queue is full, so the connection stops reading its messages.
+func (s *Server) submit(j job) {
+	w := s.workers()
+	j.queued = time.Now()
+	select {
+	case w.queue <- j:
+	default:
+		w.mu.Lock()
+		w.stats.Blocked++
+		w.mu.Unlock()
+
+		w.queue <- j
+
+		w.mu.Lock()
+		w.stats.Blocked--
+		w.stats.WaitCount++
+		w.stats.WaitDuration += time.Since(j.queued)
+		w.mu.Unlock()
+	}
+	w.mu.Lock()
+	if w.stats.Running < s.Workers {
+		w.stats.Running++
+		go w.run()
+	}
+	w.mu.Unlock()
+}
+
+func (w *workers) run() {
+	for {
+		select {
+		case j := <-w.queue:
+			w.mu.Lock()
+			w.stats.QueueDuration += time.Since(j.queued)
+			w.mu.Unlock()
+			j.c.bySegment(j.ctx, ACK, j.f)
+			j.done()
+		default:
+			w.mu.Lock()
+			if len(w.queue) == 0 {
+				w.stats.Running--
+				w.mu.Unlock()
+				return
+			}
+			w.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package tcp_test
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/rvflash/tcp"
+)
+
+func TestServer_Workers(t *testing.T) {
+	const (
+		addr = ":9143"
+		msgs = 4
+	)
+	var (
+		are     = is.New(t)
+		srv     = tcp.New()
+		release = make(chan struct{})
+	)
+	srv.Workers = 1
+	srv.QueueSize = 1
+	srv.ACK(func(c *tcp.Context) {
+		<-release
+		c.String(hiMsg)
+	})
+	go func() {
+		are.NoErr(srv.Run(addr))
+	}()
+	time.Sleep(time.Millisecond * 100)
+	are.Equal(srv.WorkerStats().Running, 0) // expected no worker
+
+	cli, err := net.Dial("tcp", addr)
+	are.NoErr(err)
+	defer func() {
+		_ = cli.Close()
+	}()
+	for i := 0; i < msgs; i++ {
+		are.NoErr(writeConn(cli, hiMsg))
+	}
+	// One message in progress, one queued, the reader is blocked by the next one.
+	var st tcp.WorkerStats
+	for i := 0; i < 50; i++ {
+		if st = srv.WorkerStats(); st.Blocked == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	are.Equal(st.Workers, 1)   // mismatch workers
+	are.Equal(st.Running, 1)   // mismatch running workers
+	are.Equal(st.QueueSize, 1) // mismatch queue size
+	are.Equal(st.Queued, 1)    // mismatch queued messages
+	are.Equal(st.Blocked, 1)   // mismatch blocked connections
+	close(release)
+
+	r := bufio.NewReader(cli)
+	for i := 0; i < msgs; i++ {
+		out, err := r.ReadString('\n')
+		are.NoErr(err)
+		are.Equal(out, hiMsg) // mismatch response
+	}
+	st = srv.WorkerStats()
+	are.Equal(st.Queued, 0)        // expected empty queue
+	are.Equal(st.Blocked, 0)       // expected no blocked connection
+	are.True(st.WaitCount >= 1)    // expected blocked connection
+	are.True(st.WaitDuration > 0)  // expected wait duration
+	are.True(st.QueueDuration > 0) // expected queue duration
+}